@@ -0,0 +1,197 @@
+package rsmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Operation is an rsmq operation whose permissions CheckPermissions reports.
+type Operation int
+
+const (
+	OpCreateQueue Operation = iota
+	OpDeleteQueue
+	OpClearQueue
+	OpSendMessage
+	OpDeleteMessage
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OpCreateQueue:
+		return "create queue"
+	case OpDeleteQueue:
+		return "delete queue"
+	case OpClearQueue:
+		return "clear queue"
+	case OpSendMessage:
+		return "send message"
+	case OpDeleteMessage:
+		return "delete message"
+	}
+	return "unknown"
+}
+
+// Permissions lists the operations the connected user may not perform.
+type Permissions struct {
+	User   string              // ACL user, empty if the server has no ACLs
+	Denied map[Operation]error // Why each denied operation would fail
+}
+
+// Allowed reports whether op is permitted.
+func (p *Permissions) Allowed(op Operation) bool {
+	_, denied := p.Denied[op]
+	return !denied
+}
+
+// permissionProbeQueue is the queue name the permission probes use. Nothing
+// is ever written to it.
+const permissionProbeQueue = "rsmqt-permission-probe"
+
+func (c *Client) CheckPermissions() (*Permissions, error) {
+	return c.CheckPermissionsContext(context.Background())
+}
+
+// CheckPermissionsContext finds out which operations the connected user may
+// perform on the namespace. ACL DRYRUN needs admin rights, which restricted
+// users rarely have, so instead the commands of each operation are queued
+// inside MULTI and discarded: Redis checks ACLs when queueing, and nothing
+// runs. Commands run by Lua scripts are probed directly in the same way.
+func (c *Client) CheckPermissionsContext(ctx context.Context) (*Permissions, error) {
+	keyZ := c.ns + permissionProbeQueue
+	keyQ := keyZ + ":Q"
+	keyQueues := c.ns + "QUEUES"
+	id := c.generateID(time.Now())
+
+	probes := []struct {
+		op   Operation
+		args []interface{}
+	}{
+		{OpCreateQueue, []interface{}{"exists", keyQ}},
+		{OpCreateQueue, []interface{}{"hmset", keyQ, "vt", 0}},
+		{OpCreateQueue, []interface{}{"sadd", keyQueues, permissionProbeQueue}},
+
+		{OpDeleteQueue, []interface{}{"del", keyQ, keyZ}},
+		{OpDeleteQueue, []interface{}{"srem", keyQueues, permissionProbeQueue}},
+
+		{OpClearQueue, []interface{}{"zcard", keyZ}},
+		{OpClearQueue, []interface{}{"zrange", keyZ, -1, -1, "withscores"}},
+		{OpClearQueue, []interface{}{"evalsha", clearBatchScript.Hash(), 2, keyZ, keyQ, 0, 0}},
+		{OpClearQueue, []interface{}{"eval", "return 0", 2, keyZ, keyQ}},
+		{OpClearQueue, []interface{}{"zrangebyscore", keyZ, "-inf", 0, "limit", 0, 0}},
+		{OpClearQueue, []interface{}{"hdel", keyQ, id}},
+		{OpClearQueue, []interface{}{"zremrangebyrank", keyZ, 0, 0}},
+
+		{OpSendMessage, []interface{}{"hmget", keyQ, "vt", "delay", "maxsize"}},
+		{OpSendMessage, []interface{}{"zcount", keyZ, "-inf", "+inf"}},
+		{OpSendMessage, []interface{}{"zadd", keyZ, 0, id}},
+		{OpSendMessage, []interface{}{"hmset", keyQ, id, ""}},
+		{OpSendMessage, []interface{}{"hincrby", keyQ, "totalsent", 1}},
+
+		{OpDeleteMessage, []interface{}{"zrem", keyZ, id}},
+		{OpDeleteMessage, []interface{}{"hdel", keyQ, id, id + ":rc", id + ":fr", id + ":sent"}},
+	}
+
+	return do(ctx, func() (*Permissions, error) {
+		perms := &Permissions{Denied: make(map[Operation]error)}
+
+		// Servers without ACLs (before Redis 6) reject WHOAMI
+		if user, err := c.rdb.Do("acl", "whoami").String(); err == nil {
+			perms.User = user
+		}
+
+		args := make([][]interface{}, len(probes))
+		for i, probe := range probes {
+			args[i] = probe.args
+		}
+		errs, err := c.queueProbes(args)
+		if errors.Is(err, ErrNoPermission) {
+			// Without a transaction the probes would run for real
+			for _, probe := range probes {
+				perms.Denied[probe.op] = err
+			}
+			return perms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, err := range errs {
+			if _, denied := perms.Denied[probes[i].op]; err != nil && !denied {
+				perms.Denied[probes[i].op] = fmt.Errorf("cannot %s: %w", probes[i].op, err)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return perms, nil
+	})
+}
+
+// queueProbes queues each command inside MULTI and discards the transaction,
+// so nothing runs. Redis checks ACLs while queueing, so the returned slice
+// holds the ErrNoPermission of each refused command and nil for the others.
+// A refused MULTI is returned as the error.
+func (c *Client) queueProbes(cmds [][]interface{}) ([]error, error) {
+	denied := make([]error, len(cmds))
+	// Watch without keys only pins a single connection, which MULTI and
+	// DISCARD need. Pipelining the probes would wrap them in a second MULTI.
+	err := c.rdb.Watch(func(tx *redis.Tx) error {
+		if err := wrapRedisError(tx.Do("multi").Err()); err != nil {
+			return err
+		}
+
+		// Keep probing after other errors so the transaction is always
+		// discarded before the connection goes back to the pool
+		var probeErr error
+		for i, args := range cmds {
+			err := wrapRedisError(tx.Do(args...).Err())
+			if errors.Is(err, ErrNoPermission) {
+				denied[i] = err
+			} else if err != nil && probeErr == nil {
+				probeErr = err
+			}
+		}
+		if err := tx.Do("discard").Err(); err != nil {
+			return err
+		}
+		return probeErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	return denied, nil
+}
+
+// execTx runs a TxPipeline. go-redis v6 drops the replies to the queued
+// commands, so a command refused by ACLs only fails the transaction with
+// EXECABORT. The commands are then probed with queueProbes to return the
+// NOPERM reply instead.
+func (c *Client) execTx(pipe redis.Pipeliner) ([]redis.Cmder, error) {
+	cmds, err := pipe.Exec()
+	if err == nil || !strings.HasPrefix(err.Error(), "EXECABORT") {
+		return cmds, err
+	}
+
+	args := make([][]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		args[i] = cmd.Args()
+	}
+	denied, probeErr := c.queueProbes(args)
+	if probeErr != nil {
+		if errors.Is(probeErr, ErrNoPermission) {
+			return cmds, probeErr
+		}
+		return cmds, err
+	}
+	for _, deniedErr := range denied {
+		if deniedErr != nil {
+			return cmds, deniedErr
+		}
+	}
+	return cmds, err
+}
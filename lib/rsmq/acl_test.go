@@ -0,0 +1,228 @@
+package rsmq
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// aclServer is a fake Redis server that denies the commands in denied and
+// queues everything else inside MULTI, like Redis 6 ACLs do. Outside MULTI
+// it answers with the raw RESP reply in replies, or +OK.
+type aclServer struct {
+	ln      net.Listener
+	denied  map[string]bool
+	replies map[string]string
+
+	mu       sync.Mutex
+	executed []string // commands run outside MULTI
+	errs     []string // protocol misuse, e.g. nested MULTI
+}
+
+func newACLServer(t *testing.T, denied ...string) *aclServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &aclServer{ln: ln, denied: make(map[string]bool), replies: make(map[string]string)}
+	for _, cmd := range denied {
+		s.denied[cmd] = true
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *aclServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	multi, aborted := false, false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToLower(args[0])
+
+		var reply string
+		s.mu.Lock()
+		switch {
+		case s.denied[name]:
+			// A refused command aborts the transaction it was queued in
+			aborted = multi
+			reply = "-NOPERM this user has no permissions to run the '" + name + "' command\r\n"
+		case name == "multi" && multi:
+			s.errs = append(s.errs, "nested MULTI")
+			reply = "-ERR MULTI calls can not be nested\r\n"
+		case name == "multi":
+			multi = true
+			reply = "+OK\r\n"
+		case name == "discard" || name == "exec":
+			switch {
+			case !multi:
+				s.errs = append(s.errs, strings.ToUpper(name)+" without MULTI")
+			case name == "exec" && !aborted:
+				s.errs = append(s.errs, "EXEC of a transaction the test cannot answer")
+			}
+			reply = "+OK\r\n"
+			if name == "exec" {
+				reply = "-EXECABORT Transaction discarded because of previous errors.\r\n"
+			}
+			multi, aborted = false, false
+		case name == "acl":
+			reply = "$5\r\nprobe\r\n"
+		case multi:
+			reply = "+QUEUED\r\n"
+		default:
+			s.executed = append(s.executed, name)
+			reply = "+OK\r\n"
+			if r, ok := s.replies[name]; ok {
+				reply = r
+			}
+		}
+		s.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestCheckPermissions(t *testing.T) {
+	tests := []struct {
+		name   string
+		denied []string
+		want   []Operation
+	}{
+		{"all allowed", nil, nil},
+		{"no writes to sorted sets", []string{"zadd", "zrem"}, []Operation{OpSendMessage, OpDeleteMessage}},
+		{"no scripts", []string{"evalsha", "eval"}, []Operation{OpClearQueue}},
+		{"no sets", []string{"sadd", "srem"}, []Operation{OpCreateQueue, OpDeleteQueue}},
+		{"no transactions", []string{"multi"}, []Operation{OpCreateQueue, OpDeleteQueue, OpClearQueue, OpSendMessage, OpDeleteMessage}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newACLServer(t, tt.denied...)
+			client := NewClient(srv.ln.Addr().String(), "", 0, "rsmq:")
+
+			perms, err := client.CheckPermissions()
+			if err != nil {
+				t.Fatalf("CheckPermissions() failed: %v", err)
+			}
+			if perms.User != "probe" {
+				t.Errorf("User = %q, want %q", perms.User, "probe")
+			}
+			for op := OpCreateQueue; op <= OpDeleteMessage; op++ {
+				want := false
+				for _, denied := range tt.want {
+					want = want || denied == op
+				}
+				if got := !perms.Allowed(op); got != want {
+					t.Errorf("%s denied = %v (%v), want %v", op, got, perms.Denied[op], want)
+				}
+				if err := perms.Denied[op]; err != nil && !errors.Is(err, ErrNoPermission) {
+					t.Errorf("%s denied with %v, want ErrNoPermission", op, err)
+				}
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if len(srv.errs) > 0 {
+				t.Errorf("protocol errors: %v", srv.errs)
+			}
+			// Only the UNWATCH of the pinned connection may run for real
+			for _, cmd := range srv.executed {
+				if cmd != "unwatch" {
+					t.Errorf("probe %q ran outside MULTI", cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionPermissionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		denied string
+		run    func(c *Client) error
+	}{
+		{"create queue", "sadd", func(c *Client) error { return c.CreateQueue("jobs", 30, 0, MaxMaxSize) }},
+		{"delete queue", "srem", func(c *Client) error { return c.DeleteQueue("jobs") }},
+		{"delete message", "zrem", func(c *Client) error { return c.DeleteMessage("jobs", "abc") }},
+		{"queue stats", "hmget", func(c *Client) error {
+			_, err := c.GetQueueStats("jobs")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newACLServer(t, tt.denied)
+			srv.replies["exists"] = ":0\r\n"
+			srv.replies["time"] = "*2\r\n$10\r\n1700000000\r\n$1\r\n0\r\n"
+			client := NewClient(srv.ln.Addr().String(), "", 0, "rsmq:")
+
+			err := tt.run(client)
+			if !errors.Is(err, ErrNoPermission) {
+				t.Fatalf("got %v, want ErrNoPermission", err)
+			}
+			if !strings.Contains(err.Error(), tt.denied) {
+				t.Errorf("error %q does not name the refused %s command", err, tt.denied)
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if len(srv.errs) > 0 {
+				t.Errorf("protocol errors: %v", srv.errs)
+			}
+		})
+	}
+}
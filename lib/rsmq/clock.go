@@ -0,0 +1,64 @@
+package rsmq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// clockRefreshInterval is how long a measured server clock offset is trusted
+// before TIME is queried again.
+const clockRefreshInterval = time.Minute
+
+// serverClock tracks the offset between the local clock and the Redis server
+// clock. rsmq derives IDs, scores and hidden counts from Redis TIME, so the
+// client must too or a skewed local clock schedules messages wrongly.
+type serverClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+	synced time.Time
+}
+
+// serverNow returns the current Redis server time, using the cached clock
+// offset while it is fresh.
+func (c *Client) serverNow(ctx context.Context) (time.Time, error) {
+	offset, err := c.clockOffset(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(offset), nil
+}
+
+func (c *Client) clockOffset(ctx context.Context) (time.Duration, error) {
+	c.clock.mu.Lock()
+	defer c.clock.mu.Unlock()
+
+	if !c.clock.synced.IsZero() && time.Since(c.clock.synced) < clockRefreshInterval {
+		return c.clock.offset, nil
+	}
+
+	start := time.Now()
+	server, err := do(ctx, func() (time.Time, error) {
+		return c.rdb.Time().Result()
+	})
+	if err != nil {
+		return 0, err
+	}
+	end := time.Now()
+
+	// Assume the server read its clock halfway through the round trip
+	local := start.Add(end.Sub(start) / 2)
+	c.clock.offset = server.Sub(local)
+	c.clock.synced = end
+	return c.clock.offset, nil
+}
+
+// ClockSkew returns how far the Redis server clock is ahead of the local
+// clock (negative if it is behind).
+func (c *Client) ClockSkew() (time.Duration, error) {
+	return c.ClockSkewContext(context.Background())
+}
+
+func (c *Client) ClockSkewContext(ctx context.Context) (time.Duration, error) {
+	return c.clockOffset(ctx)
+}
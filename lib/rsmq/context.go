@@ -0,0 +1,66 @@
+package rsmq
+
+import "context"
+
+// do runs fn and returns its result, or ctx.Err() as soon as ctx is done.
+// ACL permission errors are wrapped in ErrNoPermission.
+// go-redis v6 does not honour contexts, so a command abandoned this way still
+// completes in the background and its result is discarded, so do is only
+// used for reads. Operations that write use doWrite.
+func do[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	// Nothing can cancel, skip the goroutine
+	if ctx.Done() == nil {
+		val, err := fn()
+		return val, wrapRedisError(err)
+	}
+
+	type result struct {
+		val T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := fn()
+		done <- result{val, wrapRedisError(err)}
+	}()
+
+	select {
+	case res := <-done:
+		return res.val, res.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// run is do for functions that only return an error.
+func run(ctx context.Context, fn func() error) error {
+	_, err := do(ctx, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// doWrite is do for operations that modify data. Abandoning a write would not
+// stop it, so reporting ctx.Err() would claim a failure for a change that is
+// still applied. doWrite therefore only checks ctx before starting and then
+// waits for fn, which must check ctx itself before its first write.
+func doWrite[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	val, err := fn()
+	return val, wrapRedisError(err)
+}
+
+// runWrite is doWrite for functions that only return an error.
+func runWrite(ctx context.Context, fn func() error) error {
+	_, err := doWrite(ctx, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
@@ -0,0 +1,61 @@
+package rsmq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrQueueNotFound      = errors.New("queue not found")
+	ErrQueueExists        = errors.New("queue already exists")
+	ErrMessageTooLong     = errors.New("message too long")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrPassphraseRequired = errors.New("passphrase required")
+	ErrInvalidQueueName   = errors.New("invalid queue name")
+	ErrInvalidAttribute   = errors.New("invalid queue attribute")
+	ErrNoPermission       = errors.New("permission denied")
+)
+
+// QueueError records the queue an operation failed on. It wraps one of the
+// sentinel errors above, so callers should test it with errors.Is.
+type QueueError struct {
+	Queue string
+	Err   error
+}
+
+func (e *QueueError) Error() string {
+	return "queue " + strconv.Quote(e.Queue) + ": " + e.Err.Error()
+}
+
+func (e *QueueError) Unwrap() error {
+	return e.Err
+}
+
+// MessageError records the message an operation failed on.
+type MessageError struct {
+	Queue string
+	ID    string
+	Err   error
+}
+
+func (e *MessageError) Error() string {
+	return "message " + e.ID + " in queue " + strconv.Quote(e.Queue) + ": " + e.Err.Error()
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// wrapRedisError turns ACL NOPERM replies into ErrNoPermission. The reply
+// names the command or key that was refused.
+func wrapRedisError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, "NOPERM") {
+		return fmt.Errorf("%w: %s (the ACL user needs the hash, sorted set, set and scripting commands on the namespace keys)", ErrNoPermission, strings.TrimSpace(strings.TrimPrefix(msg, "NOPERM")))
+	}
+	return err
+}
@@ -0,0 +1,365 @@
+package rsmq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+type IntegrityIssueKind int
+
+const (
+	// IssueUnlistedQueue is a queue hash whose name is missing from QUEUES.
+	IssueUnlistedQueue IntegrityIssueKind = iota
+	// IssueMissingQueue is a QUEUES member without a queue hash.
+	IssueMissingQueue
+	// IssueOrphanedMessages are message fields in a queue hash with no entry
+	// in the queue's sorted set.
+	IssueOrphanedMessages
+)
+
+func (k IntegrityIssueKind) String() string {
+	switch k {
+	case IssueUnlistedQueue:
+		return "unlisted queue"
+	case IssueMissingQueue:
+		return "missing queue"
+	case IssueOrphanedMessages:
+		return "orphaned messages"
+	}
+	return "unknown"
+}
+
+// IntegrityIssue is a single inconsistency found by CheckIntegrity.
+type IntegrityIssue struct {
+	Kind  IntegrityIssueKind
+	Queue string
+	IDs   []string // Message IDs, for IssueOrphanedMessages
+}
+
+// IntegrityReport lists the inconsistencies found in a namespace.
+type IntegrityReport struct {
+	Namespace string
+	Queues    int // Queues checked
+	Issues    []IntegrityIssue
+}
+
+type RepairAction int
+
+const (
+	// RepairRestore makes the data usable again: unlisted queues are added
+	// to QUEUES, missing queues are recreated with rsmq's default attributes
+	// and orphaned messages are made visible. Orphaned fields without a
+	// message body cannot be restored and are purged.
+	RepairRestore RepairAction = iota
+	// RepairPurge deletes the inconsistent data.
+	RepairPurge
+)
+
+// Defaults of rsmq's createQueue, used to recreate missing queue hashes.
+const (
+	defaultVt      = 30
+	defaultDelay   = 0
+	defaultMaxSize = MaxMaxSize
+)
+
+const scanCount = 1000
+
+// queueAttributes are the non-message fields of a queue hash.
+var queueAttributes = map[string]bool{
+	"vt": true, "delay": true, "maxsize": true,
+	"totalrecv": true, "totalsent": true,
+	"created": true, "modified": true,
+}
+
+func (c *Client) CheckIntegrity(ns string) (*IntegrityReport, error) {
+	return c.CheckIntegrityContext(context.Background(), ns)
+}
+
+func (c *Client) CheckIntegrityContext(ctx context.Context, ns string) (*IntegrityReport, error) {
+	return c.CheckIntegrityWithOptionsContext(ctx, ns, CheckIntegrityOptions{})
+}
+
+// CheckIntegrityOptions controls how CheckIntegrityWithOptions reports its
+// progress.
+type CheckIntegrityOptions struct {
+	// Progress, if set, is called after the messages of each queue have been
+	// checked with the number of queues checked so far and in total.
+	Progress func(checked, total int)
+}
+
+func (c *Client) CheckIntegrityWithOptions(ns string, opts CheckIntegrityOptions) (*IntegrityReport, error) {
+	return c.CheckIntegrityWithOptionsContext(context.Background(), ns, opts)
+}
+
+// CheckIntegrityWithOptionsContext scans the namespace ns for queue hashes
+// missing from QUEUES, QUEUES members without a hash, and message fields
+// without a sorted set entry. Keys are read with SCAN and HSCAN, so the check
+// does not block the server, but changes made while it runs may be reported.
+func (c *Client) CheckIntegrityWithOptionsContext(ctx context.Context, ns string, opts CheckIntegrityOptions) (*IntegrityReport, error) {
+	report := &IntegrityReport{Namespace: ns}
+
+	listed, err := do(ctx, func() ([]string, error) {
+		return c.rdb.SMembers(ns + "QUEUES").Result()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var hashed []string
+	err = scan(ctx, func(cursor uint64) ([]string, uint64, error) {
+		return c.rdb.Scan(cursor, escapeGlob(ns)+"*:Q", scanCount).Result()
+	}, func(keys []string) error {
+		for _, key := range keys {
+			qname := strings.TrimSuffix(strings.TrimPrefix(key, ns), ":Q")
+			// Queue names cannot contain ':', so these belong to a nested
+			// namespace
+			if !strings.Contains(qname, ":") {
+				hashed = append(hashed, qname)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	isListed := make(map[string]bool, len(listed))
+	for _, qname := range listed {
+		isListed[qname] = true
+	}
+	isHashed := make(map[string]bool, len(hashed))
+	for _, qname := range hashed {
+		isHashed[qname] = true
+	}
+
+	sort.Strings(hashed)
+	sort.Strings(listed)
+	for _, qname := range hashed {
+		if !isListed[qname] {
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueUnlistedQueue, Queue: qname})
+		}
+	}
+	for _, qname := range listed {
+		if !isHashed[qname] {
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueMissingQueue, Queue: qname})
+		}
+	}
+
+	for i, qname := range hashed {
+		ids, err := c.orphanedMessages(ctx, ns, qname)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueOrphanedMessages, Queue: qname, IDs: ids})
+		}
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(hashed))
+		}
+	}
+	report.Queues = len(hashed)
+
+	return report, nil
+}
+
+// orphanedMessages returns the IDs of messages with fields in the queue hash
+// but no entry in the queue's sorted set. Each HSCAN batch is checked as it
+// arrives, so only the orphans are kept in memory.
+func (c *Client) orphanedMessages(ctx context.Context, ns, qname string) ([]string, error) {
+	keyQ := ns + qname + ":Q"
+	keyZ := ns + qname
+
+	orphaned := make(map[string]bool)
+	err := scan(ctx, func(cursor uint64) ([]string, uint64, error) {
+		// HSCAN returns field/value pairs
+		kv, cursor, err := c.rdb.HScan(keyQ, cursor, "*", scanCount).Result()
+		fields := make([]string, 0, len(kv)/2)
+		for i := 0; i < len(kv); i += 2 {
+			fields = append(fields, kv[i])
+		}
+		return fields, cursor, err
+	}, func(fields []string) error {
+		// The fields of a message may span batches and HSCAN may repeat a
+		// field, so an ID can be checked more than once
+		var ids []string
+		inBatch := make(map[string]bool)
+		for _, field := range fields {
+			if queueAttributes[field] {
+				continue
+			}
+			id := field
+			for _, suffix := range []string{":rc", ":fr", ":sent"} {
+				id = strings.TrimSuffix(id, suffix)
+			}
+			if !inBatch[id] && !orphaned[id] {
+				inBatch[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		scores, err := do(ctx, func() ([]*redis.FloatCmd, error) {
+			pipe := c.rdb.Pipeline()
+			cmds := make([]*redis.FloatCmd, len(ids))
+			for i, id := range ids {
+				cmds[i] = pipe.ZScore(keyZ, id)
+			}
+			if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+				return nil, err
+			}
+			return cmds, nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, cmd := range scores {
+			if cmd.Err() == redis.Nil {
+				orphaned[ids[i]] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(orphaned))
+	for id := range orphaned {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// scan runs a SCAN-style command until the cursor returns to 0, calling fn
+// with the keys of each batch. An error from fn stops the scan.
+func scan(ctx context.Context, next func(cursor uint64) ([]string, uint64, error), fn func([]string) error) error {
+	var cursor uint64
+	for first := true; first || cursor != 0; first = false {
+		var keys []string
+		err := run(ctx, func() error {
+			var err error
+			keys, cursor, err = next(cursor)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := fn(keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) RepairIntegrity(ns string, issue IntegrityIssue, action RepairAction) error {
+	return c.RepairIntegrityContext(context.Background(), ns, issue, action)
+}
+
+// RepairIntegrityContext fixes an issue reported by CheckIntegrity for the
+// namespace ns. Orphaned messages are re-checked atomically, so messages that
+// were re-added since the check are left untouched.
+func (c *Client) RepairIntegrityContext(ctx context.Context, ns string, issue IntegrityIssue, action RepairAction) error {
+	keyQ := ns + issue.Queue + ":Q"
+	keyZ := ns + issue.Queue
+
+	switch issue.Kind {
+	case IssueUnlistedQueue:
+		return runWrite(ctx, func() error {
+			if action == RepairRestore {
+				return c.rdb.SAdd(ns+"QUEUES", issue.Queue).Err()
+			}
+			return c.rdb.Del(keyQ, keyZ).Err()
+		})
+
+	case IssueMissingQueue:
+		if action == RepairPurge {
+			return runWrite(ctx, func() error {
+				pipe := c.rdb.TxPipeline()
+				pipe.SRem(ns+"QUEUES", issue.Queue)
+				pipe.Del(keyZ)
+				_, err := c.execTx(pipe)
+				return err
+			})
+		}
+
+		now, err := c.serverNow(ctx)
+		if err != nil {
+			return err
+		}
+		return runWrite(ctx, func() error {
+			// HSETNX keeps any fields written since the check
+			pipe := c.rdb.TxPipeline()
+			for field, value := range map[string]interface{}{
+				"vt":        defaultVt,
+				"delay":     defaultDelay,
+				"maxsize":   defaultMaxSize,
+				"created":   now.Unix(),
+				"modified":  now.Unix(),
+				"totalrecv": 0,
+				"totalsent": 0,
+			} {
+				pipe.HSetNX(keyQ, field, value)
+			}
+			_, err := c.execTx(pipe)
+			return err
+		})
+
+	case IssueOrphanedMessages:
+		if len(issue.IDs) == 0 {
+			return nil
+		}
+		now, err := c.serverNow(ctx)
+		if err != nil {
+			return err
+		}
+		mode := "purge"
+		if action == RepairRestore {
+			mode = "restore"
+		}
+		args := make([]interface{}, 0, len(issue.IDs)+2)
+		args = append(args, mode, now.UnixMilli())
+		for _, id := range issue.IDs {
+			args = append(args, id)
+		}
+		return runWrite(ctx, func() error {
+			return repairMessagesScript.Run(c.rdb, []string{keyQ, keyZ}, args...).Err()
+		})
+	}
+
+	return fmt.Errorf("unknown integrity issue kind %d", issue.Kind)
+}
+
+// repairMessagesScript restores or purges message fields with no sorted set
+// entry. ARGV: mode ("restore" or "purge"), visible-at score, IDs...
+var repairMessagesScript = redis.NewScript(`local n = 0
+for i = 3, #ARGV do
+	local id = ARGV[i]
+	if not redis.call("ZSCORE", KEYS[2], id) then
+		if ARGV[1] == "restore" and redis.call("HEXISTS", KEYS[1], id) == 1 then
+			redis.call("ZADD", KEYS[2], ARGV[2], id)
+		else
+			redis.call("HDEL", KEYS[1], id, id .. ":rc", id .. ":fr", id .. ":sent")
+		end
+		n = n + 1
+	end
+end
+return n`)
+
+// escapeGlob escapes the SCAN MATCH metacharacters in s.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package rsmq
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultIterateBatchSize is used by IterateMessages when batchSize <= 0.
+const DefaultIterateBatchSize = 1000
+
+// IterateMessages calls fn for every message in the queue in visibility
+// order, fetching batchSize messages at a time so the queue is never loaded
+// into memory at once. Iteration stops at the first error returned by fn,
+// which IterateMessages then returns.
+//
+// The queue is not locked: messages received or sent while iterating may be
+// skipped or visited twice, and messages deleted between batches are returned
+// with an empty body.
+func (c *Client) IterateMessages(ctx context.Context, qname string, batchSize int64, fn func(Message) error) error {
+	if batchSize <= 0 {
+		batchSize = DefaultIterateBatchSize
+	}
+	key := c.ns + qname
+
+	// Resume each batch at the last score seen, skipping the members with
+	// that score which were already returned
+	lo := "-inf"
+	var skip int64
+
+	for {
+		zres, err := do(ctx, func() ([]redis.Z, error) {
+			return c.rdb.ZRangeByScoreWithScores(key, redis.ZRangeBy{
+				Min:    lo,
+				Max:    "+inf",
+				Offset: skip,
+				Count:  batchSize,
+			}).Result()
+		})
+		if err != nil {
+			return err
+		}
+		if len(zres) == 0 {
+			return nil
+		}
+
+		msgs, err := do(ctx, func() ([]Message, error) {
+			return c.loadMessages(qname, zres)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, m := range msgs {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+
+		if int64(len(zres)) < batchSize {
+			return nil
+		}
+
+		last := zres[len(zres)-1].Score
+		var seen int64
+		for i := len(zres) - 1; i >= 0 && zres[i].Score == last; i-- {
+			seen++
+		}
+
+		next := strconv.FormatFloat(last, 'f', -1, 64)
+		if next == lo {
+			// The whole batch shared the previous score
+			skip += seen
+		} else {
+			skip = seen
+		}
+		lo = next
+	}
+}
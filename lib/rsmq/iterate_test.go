@@ -0,0 +1,188 @@
+package rsmq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// zsetServer is a fake Redis server holding one queue, answering the
+// ZRANGEBYSCORE and HMGET commands IterateMessages sends.
+type zsetServer struct {
+	ln     net.Listener
+	ids    []string  // in score order
+	scores []float64 // score of each id
+
+	mu     sync.Mutex
+	ranges int // ZRANGEBYSCORE calls
+}
+
+func newZsetServer(t *testing.T, scores ...float64) *zsetServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &zsetServer{ln: ln, scores: scores}
+	for i := range scores {
+		s.ids = append(s.ids, "m"+strconv.Itoa(i))
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func (s *zsetServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToLower(args[0]) {
+		case "zrangebyscore":
+			reply = s.zrangeByScore(args)
+		case "hmget":
+			// Bodies are "body " + id; the rc and fr fields are unset
+			reply = "*" + strconv.Itoa(len(args)-2) + "\r\n"
+			for _, field := range args[2:] {
+				if strings.Contains(field, ":") {
+					reply += "$-1\r\n"
+				} else {
+					reply += bulk("body " + field)
+				}
+			}
+		default:
+			reply = "-ERR unexpected " + args[0] + "\r\n"
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// zrangeByScore answers ZRANGEBYSCORE key min +inf WITHSCORES LIMIT offset count.
+func (s *zsetServer) zrangeByScore(args []string) string {
+	s.mu.Lock()
+	s.ranges++
+	s.mu.Unlock()
+
+	lo := -1e308
+	if args[2] != "-inf" {
+		lo, _ = strconv.ParseFloat(args[2], 64)
+	}
+	var offset, count int
+	for i, arg := range args {
+		if strings.EqualFold(arg, "limit") {
+			offset, _ = strconv.Atoi(args[i+1])
+			count, _ = strconv.Atoi(args[i+2])
+		}
+	}
+
+	var reply []string
+	for i, score := range s.scores {
+		if score < lo {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(reply)/2 == count {
+			break
+		}
+		reply = append(reply, s.ids[i], strconv.FormatFloat(score, 'f', -1, 64))
+	}
+
+	out := "*" + strconv.Itoa(len(reply)) + "\r\n"
+	for _, v := range reply {
+		out += bulk(v)
+	}
+	return out
+}
+
+func TestIterateMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		scores    []float64
+		batchSize int64
+	}{
+		{"empty", nil, 2},
+		{"distinct scores", []float64{1, 2, 3, 4, 5}, 2},
+		{"exact batches", []float64{1, 2, 3, 4}, 2},
+		{"equal scores span batches", []float64{1, 1, 1, 1, 1, 2, 3}, 2},
+		{"batch at the previous score", []float64{1, 2, 2, 2, 2, 2, 3}, 2},
+		{"single score", []float64{7, 7, 7, 7, 7}, 2},
+		{"batch of one", []float64{1, 1, 2, 2, 3}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newZsetServer(t, tt.scores...)
+			client := NewClient(srv.ln.Addr().String(), "", 0, "rsmq:")
+
+			var got []string
+			err := client.IterateMessages(context.Background(), "q", tt.batchSize, func(m Message) error {
+				if m.Body != "body "+m.ID {
+					t.Errorf("message %s has body %q", m.ID, m.Body)
+				}
+				got = append(got, m.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("IterateMessages() failed: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(srv.ids, ",") {
+				t.Errorf("visited %v, want %v", got, srv.ids)
+			}
+		})
+	}
+}
+
+func TestIterateMessagesStop(t *testing.T) {
+	srv := newZsetServer(t, 1, 2, 3, 4, 5, 6)
+	client := NewClient(srv.ln.Addr().String(), "", 0, "rsmq:")
+
+	errStop := errors.New("stop")
+	visited := 0
+	err := client.IterateMessages(context.Background(), "q", 2, func(m Message) error {
+		visited++
+		if visited == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("IterateMessages() = %v, want the callback's error", err)
+	}
+	if visited != 3 {
+		t.Errorf("visited %d messages, want 3", visited)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.ranges != 2 {
+		t.Errorf("fetched %d batches, want 2", srv.ranges)
+	}
+}
@@ -0,0 +1,280 @@
+package rsmq
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ChangeKind int
+
+const (
+	ChangeSent ChangeKind = iota
+	ChangeReceived
+	ChangeDeleted
+	ChangeVisibilityChanged
+	ChangeAttributesChanged
+	ChangeQueueCreated
+	ChangeQueueDeleted
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeSent:
+		return "sent"
+	case ChangeReceived:
+		return "received"
+	case ChangeDeleted:
+		return "deleted"
+	case ChangeVisibilityChanged:
+		return "visibility changed"
+	case ChangeAttributesChanged:
+		return "attributes changed"
+	case ChangeQueueCreated:
+		return "queue created"
+	case ChangeQueueDeleted:
+		return "queue deleted"
+	}
+	return "unknown"
+}
+
+// ChangeEvent is a queue change decoded from Redis keyspace notifications.
+type ChangeEvent struct {
+	Kind  ChangeKind
+	Queue string
+}
+
+// keyspaceGroupWindow is how long the decoder waits for the rest of a
+// transaction's notifications before classifying what it has seen.
+const keyspaceGroupWindow = 20 * time.Millisecond
+
+// CheckKeyspaceNotifications reports whether the server publishes the keyspace
+// notifications SubscribeKeyspace relies on. It returns nil when they are
+// enabled, or an error describing what is missing.
+func (c *Client) CheckKeyspaceNotifications() error {
+	return c.CheckKeyspaceNotificationsContext(context.Background())
+}
+
+func (c *Client) CheckKeyspaceNotificationsContext(ctx context.Context) error {
+	res, err := do(ctx, func() ([]interface{}, error) {
+		return c.rdb.ConfigGet("notify-keyspace-events").Result()
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read notify-keyspace-events: %v", err)
+	}
+
+	flags := ""
+	if len(res) == 2 {
+		flags, _ = res[1].(string)
+	}
+
+	missing := ""
+	if !strings.Contains(flags, "K") {
+		missing += "K"
+	}
+	if !strings.Contains(flags, "A") {
+		// Generic (del), hash, set and sorted set commands
+		for _, f := range "ghsz" {
+			if !strings.ContainsRune(flags, f) {
+				missing += string(f)
+			}
+		}
+	}
+	if missing != "" {
+		return fmt.Errorf("notify-keyspace-events is %q, missing %q (e.g. CONFIG SET notify-keyspace-events KA)", flags, missing)
+	}
+	return nil
+}
+
+// keyspaceToken is a single keyspace notification for a queue.
+type keyspaceToken struct {
+	queue string
+	key   byte // 'z' queue zset, 'h' queue hash, 's' QUEUES set
+	event string
+}
+
+// SubscribeKeyspace subscribes to the keyspace notifications of the namespace
+// and decodes them into ChangeEvents. Notifications carry only the command
+// name, so events are classified by matching the command sequences rsmq
+// transactions produce. The returned channel is closed once ctx is done.
+func (c *Client) SubscribeKeyspace(ctx context.Context) (<-chan ChangeEvent, error) {
+	prefix := "__keyspace@" + strconv.Itoa(c.db) + "__:" + c.ns
+
+	pubsub := c.rdb.PSubscribe(prefix + "*")
+	// Wait for the subscription to be confirmed so errors surface here
+	if _, err := do(ctx, pubsub.Receive); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	out := make(chan ChangeEvent, 64)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		var pending []keyspaceToken
+		timer := time.NewTimer(keyspaceGroupWindow)
+		timer.Stop()
+		defer timer.Stop()
+
+		flush := func() bool {
+			for _, ev := range classifyKeyspace(pending) {
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			pending = pending[:0]
+			return true
+		}
+
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				if !flush() {
+					return
+				}
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				tok, ok := parseKeyspaceToken(strings.TrimPrefix(msg.Channel, prefix), msg.Payload)
+				if !ok {
+					continue
+				}
+				// Transactions never interleave, so a different queue
+				// means the previous group is complete
+				if len(pending) > 0 && pending[0].queue != tok.queue {
+					if !flush() {
+						return
+					}
+				}
+				pending = append(pending, tok)
+				timer.Reset(keyspaceGroupWindow)
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func parseKeyspaceToken(key, event string) (keyspaceToken, bool) {
+	switch {
+	case key == "QUEUES":
+		return keyspaceToken{key: 's', event: event}, true
+	case strings.HasSuffix(key, ":Q"):
+		return keyspaceToken{queue: strings.TrimSuffix(key, ":Q"), key: 'h', event: event}, true
+	case strings.Contains(key, ":"):
+		// Not an rsmq queue key (e.g. a nested namespace)
+		return keyspaceToken{}, false
+	}
+	return keyspaceToken{queue: key, key: 'z', event: event}, true
+}
+
+// classifyKeyspace turns a group of notifications into change events. The
+// sequences handled are those emitted by rsmq and this client:
+//
+//	send:       zadd(z) hset(h) hincrby(h)
+//	receive:    zadd(z) hincrby(h) hincrby(h) [hset(h)]
+//	visibility: zadd(z)
+//	pop:        hincrby(h) hincrby(h) zrem(z) hdel(h)
+//	delete:     zrem(z) hdel(h)
+//	clear:      hdel(h)... zremrangebyrank(z) [del(z)]
+//	drop queue: del(h) [del(z)] srem(s)
+//	attributes: hset(h)...
+func classifyKeyspace(toks []keyspaceToken) []ChangeEvent {
+	var events []ChangeEvent
+
+	at := func(i int, key byte, event string) bool {
+		return i < len(toks) && toks[i].key == key && toks[i].event == event
+	}
+
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		emit := func(kind ChangeKind) {
+			events = append(events, ChangeEvent{Kind: kind, Queue: t.queue})
+		}
+
+		switch {
+		case t.key == 's':
+			// QUEUES members are queue names, which the notification omits
+			if t.event == "sadd" {
+				events = append(events, ChangeEvent{Kind: ChangeQueueCreated})
+			} else if t.event == "srem" {
+				events = append(events, ChangeEvent{Kind: ChangeQueueDeleted})
+			}
+			i++
+		case at(i, 'z', "zadd") && at(i+1, 'h', "hset"):
+			emit(ChangeSent)
+			i += 2
+			if at(i, 'h', "hincrby") {
+				i++
+			}
+		case at(i, 'z', "zadd") && at(i+1, 'h', "hincrby"):
+			emit(ChangeReceived)
+			i += 2
+			if at(i, 'h', "hincrby") {
+				i++
+			}
+			if at(i, 'h', "hset") {
+				i++
+			}
+		case at(i, 'z', "zadd"):
+			emit(ChangeVisibilityChanged)
+			i++
+		case at(i, 'h', "hincrby") && at(i+1, 'h', "hincrby") && at(i+2, 'z', "zrem"):
+			emit(ChangeReceived)
+			emit(ChangeDeleted)
+			i += 3
+			if at(i, 'h', "hdel") {
+				i++
+			}
+		case at(i, 'z', "zrem"):
+			emit(ChangeDeleted)
+			i++
+			if at(i, 'h', "hdel") {
+				i++
+			}
+		case at(i, 'h', "hdel"):
+			emit(ChangeDeleted)
+			i++
+			// Cleared in batches, one hdel per message
+			for at(i, 'h', "hdel") {
+				i++
+			}
+			if at(i, 'z', "zremrangebyrank") {
+				i++
+			}
+			if at(i, 'z', "del") {
+				i++
+			}
+		case at(i, 'h', "del"):
+			// The sorted set only exists while the queue holds messages
+			emit(ChangeDeleted)
+			i++
+			if at(i, 'z', "del") {
+				i++
+			}
+		case at(i, 'z', "del"):
+			emit(ChangeDeleted)
+			i++
+		case at(i, 'h', "hset"):
+			emit(ChangeAttributesChanged)
+			i++
+			// Attribute updates may set each field separately
+			for at(i, 'h', "hset") {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,62 @@
+package rsmq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeyspaceToken(t *testing.T) {
+	tests := []struct {
+		key   string
+		event string
+		want  keyspaceToken
+		ok    bool
+	}{
+		{"QUEUES", "sadd", keyspaceToken{key: 's', event: "sadd"}, true},
+		{"jobs:Q", "hset", keyspaceToken{queue: "jobs", key: 'h', event: "hset"}, true},
+		{"jobs", "zadd", keyspaceToken{queue: "jobs", key: 'z', event: "zadd"}, true},
+		{"nested:jobs", "zadd", keyspaceToken{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseKeyspaceToken(tt.key, tt.event)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseKeyspaceToken(%q, %q) = %+v, %v; want %+v, %v", tt.key, tt.event, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClassifyKeyspace(t *testing.T) {
+	z := func(event string) keyspaceToken { return keyspaceToken{queue: "q", key: 'z', event: event} }
+	h := func(event string) keyspaceToken { return keyspaceToken{queue: "q", key: 'h', event: event} }
+	s := func(event string) keyspaceToken { return keyspaceToken{key: 's', event: event} }
+	ev := func(kind ChangeKind) ChangeEvent { return ChangeEvent{Kind: kind, Queue: "q"} }
+
+	tests := []struct {
+		name string
+		toks []keyspaceToken
+		want []ChangeEvent
+	}{
+		{"send", []keyspaceToken{z("zadd"), h("hset"), h("hincrby")}, []ChangeEvent{ev(ChangeSent)}},
+		{"receive", []keyspaceToken{z("zadd"), h("hincrby"), h("hincrby")}, []ChangeEvent{ev(ChangeReceived)}},
+		{"first receive", []keyspaceToken{z("zadd"), h("hincrby"), h("hincrby"), h("hset")}, []ChangeEvent{ev(ChangeReceived)}},
+		{"visibility", []keyspaceToken{z("zadd")}, []ChangeEvent{ev(ChangeVisibilityChanged)}},
+		{"pop", []keyspaceToken{h("hincrby"), h("hincrby"), z("zrem"), h("hdel")}, []ChangeEvent{ev(ChangeReceived), ev(ChangeDeleted)}},
+		{"delete", []keyspaceToken{z("zrem"), h("hdel")}, []ChangeEvent{ev(ChangeDeleted)}},
+		{"clear batch", []keyspaceToken{h("hdel"), h("hdel"), h("hdel"), z("zremrangebyrank")}, []ChangeEvent{ev(ChangeDeleted)}},
+		{"clear last batch", []keyspaceToken{h("hdel"), z("zremrangebyrank"), z("del")}, []ChangeEvent{ev(ChangeDeleted)}},
+		{"attributes", []keyspaceToken{h("hset"), h("hset")}, []ChangeEvent{ev(ChangeAttributesChanged)}},
+		{"queue deleted", []keyspaceToken{h("del"), z("del"), s("srem")}, []ChangeEvent{ev(ChangeDeleted), {Kind: ChangeQueueDeleted}}},
+		{"empty queue deleted", []keyspaceToken{h("del"), s("srem")}, []ChangeEvent{ev(ChangeDeleted), {Kind: ChangeQueueDeleted}}},
+		{"queue created", []keyspaceToken{s("sadd")}, []ChangeEvent{{Kind: ChangeQueueCreated}}},
+		{"unknown", []keyspaceToken{z("expire")}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyKeyspace(tt.toks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classifyKeyspace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package rsmq
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// Namespace is an rsmq namespace found by DiscoverNamespaces.
+type Namespace struct {
+	Name   string // Key prefix, including the trailing ':' (e.g. "rsmq:")
+	Queues int64
+}
+
+// WithNamespace returns a client for the namespace ns that shares c's
+// connection pool, server clock offset and settings.
+func (c *Client) WithNamespace(ns string) *Client {
+	return &Client{
+		rdb:      c.rdb,
+		db:       c.db,
+		ns:       ns,
+		realtime: c.realtime,
+		clock:    c.clock,
+		sentinel: c.sentinel,
+		// Share the sentinel connections instead of dialing new ones
+		sentinels: c.sentinels,
+	}
+}
+
+// Namespace returns the namespace the client operates on.
+func (c *Client) Namespace() string {
+	return c.ns
+}
+
+func (c *Client) DiscoverNamespaces() ([]Namespace, error) {
+	return c.DiscoverNamespacesContext(context.Background())
+}
+
+// DiscoverNamespacesContext scans the database for rsmq QUEUES sets and
+// returns their namespaces with the number of queues in each, sorted by name.
+func (c *Client) DiscoverNamespacesContext(ctx context.Context) ([]Namespace, error) {
+	var keys []string
+	err := scan(ctx, func(cursor uint64) ([]string, uint64, error) {
+		return c.rdb.Scan(cursor, "*QUEUES", scanCount).Result()
+	}, func(batch []string) error {
+		keys = append(keys, batch...)
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	// SCAN ... TYPE needs Redis 6, so filter out keys that are not sets
+	types, err := do(ctx, func() ([]*redis.StatusCmd, error) {
+		pipe := c.rdb.Pipeline()
+		cmds := make([]*redis.StatusCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.Type(key)
+		}
+		_, err := pipe.Exec()
+		return cmds, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sets []string
+	for i, cmd := range types {
+		if cmd.Val() == "set" {
+			sets = append(sets, keys[i])
+		}
+	}
+	if len(sets) == 0 {
+		return nil, nil
+	}
+
+	counts, err := do(ctx, func() ([]*redis.IntCmd, error) {
+		pipe := c.rdb.Pipeline()
+		cmds := make([]*redis.IntCmd, len(sets))
+		for i, key := range sets {
+			cmds[i] = pipe.SCard(key)
+		}
+		_, err := pipe.Exec()
+		return cmds, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]Namespace, len(sets))
+	for i, key := range sets {
+		namespaces[i] = Namespace{
+			Name:   strings.TrimSuffix(key, "QUEUES"),
+			Queues: counts[i].Val(),
+		}
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return namespaces, nil
+}
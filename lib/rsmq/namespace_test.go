@@ -0,0 +1,23 @@
+package rsmq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithNamespaceSharesClock(t *testing.T) {
+	// Nothing listens here, so only a cached offset can be returned
+	c := NewClient("127.0.0.1:1", "", 0, "a:")
+	c.clock.offset = 3 * time.Second
+	c.clock.synced = time.Now()
+
+	other := c.WithNamespace("b:")
+	offset, err := other.ClockSkewContext(context.Background())
+	if err != nil {
+		t.Fatalf("ClockSkew() failed: %v", err)
+	}
+	if offset != 3*time.Second {
+		t.Errorf("ClockSkew() = %v, want the cached 3s", offset)
+	}
+}
@@ -0,0 +1,46 @@
+package rsmq
+
+import (
+	"context"
+	"strings"
+)
+
+// SubscribeRealtime subscribes to the rsmq realtime channels ("{ns}rt:*") of
+// the namespace. The returned channel receives the queue name every time a
+// realtime client sends a message to it, and is closed once ctx is done.
+func (c *Client) SubscribeRealtime(ctx context.Context) (<-chan string, error) {
+	prefix := c.ns + "rt:"
+
+	pubsub := c.rdb.PSubscribe(prefix + "*")
+	// Wait for the subscription to be confirmed so errors surface here
+	if _, err := do(ctx, pubsub.Receive); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	out := make(chan string, 16)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				qname := strings.TrimPrefix(msg.Channel, prefix)
+				select {
+				case out <- qname:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
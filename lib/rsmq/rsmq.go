@@ -1,9 +1,12 @@
 package rsmq
 
 import (
-	"errors"
+	"context"
+	"crypto/tls"
+	"fmt"
 	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,8 +19,14 @@ func init() {
 }
 
 type Client struct {
-	rdb *redis.Client
-	ns  string
+	rdb      *redis.Client
+	db       int
+	ns       string
+	realtime bool
+	clock    *serverClock // shared by WithNamespace, the server is the same
+	sentinel *SentinelOptions
+	// One client per sentinel address, reused by every master lookup
+	sentinels []*redis.SentinelClient
 }
 
 func NewClient(addr, password string, db int, ns string) *Client {
@@ -25,37 +34,145 @@ func NewClient(addr, password string, db int, ns string) *Client {
 }
 
 func NewClientWithDialer(addr, password string, db int, ns string, dialer func(string, string) (net.Conn, error)) *Client {
-	if ns == "" {
-		ns = "rsmq:"
-	}
-	opts := &redis.Options{
+	// Only TLS options can fail to load
+	c, _ := NewClientWithOptions(ClientOptions{
 		Addr:     addr,
 		Password: password,
 		DB:       db,
+		NS:       ns,
+		Dialer:   dialer,
+	})
+	return c
+}
+
+// tlsHandshakeTimeout matches go-redis's default dial timeout.
+const tlsHandshakeTimeout = 5 * time.Second
+
+// ClientOptions configures NewClientWithOptions.
+type ClientOptions struct {
+	Network  string // "tcp" (default) or "unix"
+	Addr     string // host:port, or the socket path for "unix"
+	Username string // Redis 6 ACL user; empty for the default user
+	Password string
+	DB       int
+	NS       string // Defaults to "rsmq:"
+
+	// Dialer, if set, opens the connections to Addr, e.g. through an SSH
+	// tunnel from DialSSH, which also reaches unix sockets on the SSH host
+	Dialer func(network, addr string) (net.Conn, error)
+	// TLS, if set, negotiates TLS on every connection, including those
+	// opened by Dialer
+	TLS *TLSOptions
+	// Sentinel, if set, connects to the master the sentinels report instead
+	// of Addr and follows failovers. It cannot be combined with Network,
+	// Dialer or TLS.
+	Sentinel *SentinelOptions
+}
+
+// NewClientWithOptions creates a client from opts. It fails only if the TLS
+// options cannot be loaded or the options conflict; the connection itself is
+// opened lazily.
+func NewClientWithOptions(opts ClientOptions) (*Client, error) {
+	ns := opts.NS
+	if ns == "" {
+		ns = "rsmq:"
+	}
+
+	if opts.Sentinel != nil {
+		return newSentinelClient(opts, ns)
 	}
-	if dialer != nil {
-		opts.Dialer = func() (net.Conn, error) {
-			return dialer("tcp", addr)
+
+	network := opts.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	var tlsConfig *tls.Config
+	if opts.TLS != nil {
+		// A socket path is not a host name to verify the certificate against
+		tlsAddr := opts.Addr
+		if network == "unix" {
+			tlsAddr = "localhost"
+		}
+		var err error
+		tlsConfig, err = opts.TLS.Config(tlsAddr)
+		if err != nil {
+			return nil, err
 		}
 	}
-	rdb := redis.NewClient(opts)
+
+	ropts := &redis.Options{
+		Network:   network,
+		Addr:      opts.Addr,
+		Password:  opts.Password,
+		DB:        opts.DB,
+		TLSConfig: tlsConfig,
+	}
+	if opts.Username != "" {
+		ropts.Password = ""
+		ropts.DB = 0
+		ropts.OnConnect = aclOnConnect(opts)
+	}
+	if opts.Dialer != nil {
+		// A custom dialer replaces go-redis's own, which is where TLSConfig
+		// would otherwise be applied
+		ropts.Dialer = func() (net.Conn, error) {
+			conn, err := opts.Dialer(network, opts.Addr)
+			if err != nil || tlsConfig == nil {
+				return conn, err
+			}
+			tlsConn := tls.Client(conn, tlsConfig)
+			ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+			defer cancel()
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+	}
+	rdb := redis.NewClient(ropts)
 	return &Client{
-		rdb: rdb,
-		ns:  ns,
+		rdb:   rdb,
+		db:    opts.DB,
+		ns:    ns,
+		clock: &serverClock{},
+	}, nil
+}
+
+// aclOnConnect authenticates new connections as opts.Username. go-redis v6
+// only sends AUTH <password>, and SELECT before the OnConnect hook, so the
+// client must be created without a password or DB and both are sent here.
+func aclOnConnect(opts ClientOptions) func(*redis.Conn) error {
+	return func(conn *redis.Conn) error {
+		if err := conn.Do("auth", opts.Username, opts.Password).Err(); err != nil {
+			return fmt.Errorf("AUTH as %q failed: %w", opts.Username, err)
+		}
+		if opts.DB > 0 {
+			return conn.Select(opts.DB).Err()
+		}
+		return nil
 	}
 }
 
+// SetRealtime enables rsmq's realtime mode: every sent message publishes the
+// queue length to the "{ns}rt:{qname}" channel.
+func (c *Client) SetRealtime(enabled bool) {
+	c.realtime = enabled
+}
+
 type QueueStats struct {
 	Name       string
 	Vt         int
 	Delay      int
-	MaxSize    int
+	MaxSize    int // UnlimitedMaxSize (-1) means no limit
 	TotalRecv  uint64
 	TotalSent  uint64
 	Created    time.Time
 	Modified   time.Time
 	Msgs       int64
 	HiddenMsgs int64
+	OldestAge  time.Duration // Age of the oldest message by send time, 0 if empty
 }
 
 type Message struct {
@@ -68,25 +185,147 @@ type Message struct {
 }
 
 func (c *Client) TestConnection() error {
-	return c.rdb.Ping().Err()
+	return c.TestConnectionContext(context.Background())
+}
+
+func (c *Client) TestConnectionContext(ctx context.Context) error {
+	return run(ctx, func() error {
+		return c.rdb.Ping().Err()
+	})
 }
 
 func (c *Client) ListQueues() ([]string, error) {
-	return c.rdb.SMembers(c.ns + "QUEUES").Result()
+	return c.ListQueuesContext(context.Background())
+}
+
+func (c *Client) ListQueuesContext(ctx context.Context) ([]string, error) {
+	return do(ctx, func() ([]string, error) {
+		return c.rdb.SMembers(c.ns + "QUEUES").Result()
+	})
 }
 
 func (c *Client) GetQueueStats(qname string) (*QueueStats, error) {
-	key := c.ns + qname
-	// Get Attributes from Hash
-	// Fields: vt, delay, maxsize, totalrecv, totalsent, created, modified
-	res, err := c.rdb.HMGet(key+":Q", "vt", "delay", "maxsize", "totalrecv", "totalsent", "created", "modified").Result()
+	return c.GetQueueStatsContext(context.Background(), qname)
+}
+
+func (c *Client) GetQueueStatsContext(ctx context.Context, qname string) (*QueueStats, error) {
+	return do(ctx, func() (*QueueStats, error) {
+		now, err := c.serverNow(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		pipe := c.rdb.TxPipeline()
+		cmds := c.queueStatsPipe(pipe, qname, now)
+		if _, err := c.execTx(pipe); err != nil {
+			return nil, err
+		}
+
+		stats := cmds.stats(qname, now)
+		if stats == nil {
+			return nil, &QueueError{Queue: qname, Err: ErrQueueNotFound}
+		}
+		return stats, nil
+	})
+}
+
+func (c *Client) GetAllQueueStats() ([]*QueueStats, error) {
+	return c.GetAllQueueStatsContext(context.Background())
+}
+
+// GetAllQueueStatsContext returns the stats of every queue in the namespace,
+// sorted by name. The stats of all queues are fetched in a single pipeline.
+func (c *Client) GetAllQueueStatsContext(ctx context.Context) ([]*QueueStats, error) {
+	queues, err := do(ctx, func() ([]string, error) {
+		return c.rdb.SMembers(c.ns + "QUEUES").Result()
+	})
 	if err != nil {
 		return nil, err
 	}
+	sort.Strings(queues)
+	return c.GetQueuesStatsContext(ctx, queues)
+}
+
+func (c *Client) GetQueuesStats(qnames []string) ([]*QueueStats, error) {
+	return c.GetQueuesStatsContext(context.Background(), qnames)
+}
+
+// GetQueuesStatsContext returns the stats of the queues qnames, in the same
+// order, fetched in a single pipeline. Queues that do not exist are left out.
+func (c *Client) GetQueuesStatsContext(ctx context.Context, qnames []string) ([]*QueueStats, error) {
+	if len(qnames) == 0 {
+		return nil, nil
+	}
+
+	now, err := c.serverNow(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return do(ctx, func() ([]*QueueStats, error) {
+		pipe := c.rdb.Pipeline()
+		cmds := make([]queueStatsCmds, len(qnames))
+		for i, qname := range qnames {
+			cmds[i] = c.queueStatsPipe(pipe, qname, now)
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return nil, err
+		}
+
+		all := make([]*QueueStats, 0, len(qnames))
+		for i, qname := range qnames {
+			if stats := cmds[i].stats(qname, now); stats != nil {
+				all = append(all, stats)
+			}
+		}
+		return all, nil
+	})
+}
+
+// queueStatsCmds are the queued commands making up the stats of one queue.
+type queueStatsCmds struct {
+	attrs  *redis.SliceCmd
+	msgs   *redis.IntCmd
+	hidden *redis.IntCmd
+	oldest *redis.Cmd
+}
+
+func (c *Client) queueStatsPipe(pipe redis.Pipeliner, qname string, now time.Time) queueStatsCmds {
+	key := c.ns + qname
+	return queueStatsCmds{
+		// Fields: vt, delay, maxsize, totalrecv, totalsent, created, modified
+		attrs: pipe.HMGet(key+":Q", "vt", "delay", "maxsize", "totalrecv", "totalsent", "created", "modified"),
+		msgs:  pipe.ZCard(key),
+		// Hidden messages have a score after now
+		hidden: pipe.ZCount(key, strconv.FormatInt(now.UnixMilli(), 10), "+inf"),
+		oldest: oldestIDScript.Eval(pipe, []string{key}),
+	}
+}
+
+// oldestIDScript returns the send time prefix of the oldest message ID in a
+// queue, or "" if it is empty. Scores are visibility times, which receiving
+// resets, so the whole set is read: the IDs start with the send time as
+// fixed-width base36, so the lowest prefix is the oldest message.
+var oldestIDScript = redis.NewScript(`local oldest = ""
+local n = redis.call("ZCARD", KEYS[1])
+for start = 0, n - 1, 1000 do
+	for _, id in ipairs(redis.call("ZRANGE", KEYS[1], start, start + 999)) do
+		local ts = string.sub(id, 1, 10)
+		if oldest == "" or ts < oldest then
+			oldest = ts
+		end
+	end
+end
+return oldest`)
+
+// stats builds the QueueStats from the executed commands. It returns nil if
+// the queue does not exist.
+func (q queueStatsCmds) stats(qname string, now time.Time) *QueueStats {
+	res := q.attrs.Val()
 
 	// If all nil, queue might not exist
 	if len(res) == 0 || res[0] == nil {
-		return nil, errors.New("queue not found")
+		return nil
 	}
 
 	toInt := func(v interface{}) int {
@@ -114,42 +353,176 @@ func (c *Client) GetQueueStats(qname string) (*QueueStats, error) {
 	}
 
 	stats := &QueueStats{
-		Name:      qname,
-		Vt:        toInt(res[0]),
-		Delay:     toInt(res[1]),
-		MaxSize:   toInt(res[2]),
-		TotalRecv: toUint64(res[3]),
-		TotalSent: toUint64(res[4]),
-		Created:   time.Unix(toInt64(res[5]), 0),
-		Modified:  time.Unix(toInt64(res[6]), 0),
+		Name:       qname,
+		Vt:         toInt(res[0]),
+		Delay:      toInt(res[1]),
+		MaxSize:    toInt(res[2]), // Atoi keeps rsmq's -1 (unlimited)
+		TotalRecv:  toUint64(res[3]),
+		TotalSent:  toUint64(res[4]),
+		Created:    time.Unix(toInt64(res[5]), 0),
+		Modified:   time.Unix(toInt64(res[6]), 0),
+		Msgs:       q.msgs.Val(),
+		HiddenMsgs: q.hidden.Val(),
 	}
+	if ts, _ := q.oldest.Val().(string); ts != "" {
+		stats.OldestAge = now.Sub(parseIDTime(ts))
+	}
+
+	return stats
+}
+
+func (c *Client) ListMessages(qname string) ([]Message, error) {
+	return c.ListMessagesContext(context.Background(), qname)
+}
+
+func (c *Client) ListMessagesContext(ctx context.Context, qname string) ([]Message, error) {
+	return do(ctx, func() ([]Message, error) {
+		key := c.ns + qname
+
+		// Get all members from ZSet with scores
+		zres, err := c.rdb.ZRangeWithScores(key, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
 
-	// Get Msgs Count (ZCard)
-	stats.Msgs, _ = c.rdb.ZCard(key).Result()
+		return c.loadMessages(qname, zres)
+	})
+}
 
-	// Get Hidden Msgs Count (ZCount where score > now)
-	nowMs := time.Now().UnixNano() / 1e6
-	stats.HiddenMsgs, _ = c.rdb.ZCount(key, strconv.FormatInt(nowMs, 10), "+inf").Result()
+type MessageFilter int
+
+const (
+	FilterAll MessageFilter = iota
+	// FilterVisible selects messages that can be received now
+	FilterVisible
+	// FilterHidden selects in-flight and delayed messages
+	FilterHidden
+)
 
-	return stats, nil
+// ListMessagesOptions selects a page of messages in visibility order.
+type ListMessagesOptions struct {
+	Filter MessageFilter
+	// VisibleFrom and VisibleTo restrict the visibility time to a window.
+	// A zero value leaves that end of the window open.
+	VisibleFrom time.Time
+	VisibleTo   time.Time
+	Offset      int64
+	// Limit is the page size. Zero returns every message after Offset.
+	Limit int64
 }
 
-func (c *Client) ListMessages(qname string) ([]Message, error) {
-	key := c.ns + qname
+// MessagePage is a page of messages returned by ListMessagesRange.
+type MessagePage struct {
+	Messages []Message
+	// Total is the number of messages matching the filter, across all pages
+	Total int64
+	// Offset is the offset of the first message. It is lower than the
+	// requested offset if that was past the end, e.g. after deletions.
+	Offset int64
+}
 
-	// Get all members from ZSet with scores
-	zres, err := c.rdb.ZRangeWithScores(key, 0, -1).Result()
-	if err != nil {
-		return nil, err
+func (c *Client) ListMessagesRange(qname string, opts ListMessagesOptions) (*MessagePage, error) {
+	return c.ListMessagesRangeContext(context.Background(), qname, opts)
+}
+
+func (c *Client) ListMessagesRangeContext(ctx context.Context, qname string, opts ListMessagesOptions) (*MessagePage, error) {
+	return do(ctx, func() (*MessagePage, error) {
+		key := c.ns + qname
+
+		lo, hi := "-inf", "+inf"
+		if opts.Filter != FilterAll {
+			now, err := c.serverNow(ctx)
+			if err != nil {
+				return nil, err
+			}
+			nowMs := strconv.FormatInt(now.UnixMilli(), 10)
+			if opts.Filter == FilterVisible {
+				hi = nowMs
+			} else {
+				lo = "(" + nowMs
+			}
+		}
+		if !opts.VisibleFrom.IsZero() {
+			lo = tightenMin(lo, opts.VisibleFrom.UnixMilli())
+		}
+		if !opts.VisibleTo.IsZero() {
+			hi = tightenMax(hi, opts.VisibleTo.UnixMilli())
+		}
+
+		count := opts.Limit
+		if count == 0 {
+			count = -1
+		}
+
+		// Count and range in one transaction so Total matches the page
+		fetch := func(offset int64) (int64, []redis.Z, error) {
+			pipe := c.rdb.TxPipeline()
+			total := pipe.ZCount(key, lo, hi)
+			zrange := pipe.ZRangeByScoreWithScores(key, redis.ZRangeBy{
+				Min:    lo,
+				Max:    hi,
+				Offset: offset,
+				Count:  count,
+			})
+			_, err := c.execTx(pipe)
+			return total.Val(), zrange.Val(), err
+		}
+
+		offset := opts.Offset
+		total, zres, err := fetch(offset)
+		if err != nil {
+			return nil, err
+		}
+		// Messages deleted since the page was chosen can leave the offset
+		// past the end; return the last page instead
+		if len(zres) == 0 && offset > 0 {
+			offset = 0
+			if total > 0 && opts.Limit > 0 {
+				offset = (total - 1) / opts.Limit * opts.Limit
+			}
+			if total > 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				if total, zres, err = fetch(offset); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		msgs, err := c.loadMessages(qname, zres)
+		if err != nil {
+			return nil, err
+		}
+		return &MessagePage{Messages: msgs, Total: total, Offset: offset}, nil
+	})
+}
+
+// tightenMin returns the tighter of a ZRANGEBYSCORE lower bound and ms.
+func tightenMin(lo string, ms int64) string {
+	if cur, err := strconv.ParseInt(strings.TrimPrefix(lo, "("), 10, 64); err == nil && cur >= ms {
+		return lo
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// tightenMax returns the tighter of a ZRANGEBYSCORE upper bound and ms.
+func tightenMax(hi string, ms int64) string {
+	if cur, err := strconv.ParseInt(strings.TrimPrefix(hi, "("), 10, 64); err == nil && cur <= ms {
+		return hi
 	}
+	return strconv.FormatInt(ms, 10)
+}
 
+// loadMessages fetches the body, rc and fr fields for the given zset members.
+func (c *Client) loadMessages(qname string, zres []redis.Z) ([]Message, error) {
 	if len(zres) == 0 {
 		return []Message{}, nil
 	}
 
 	msgs := make([]Message, len(zres))
 
-	hashKey := key + ":Q"
+	hashKey := c.ns + qname + ":Q"
 	fields := make([]string, 0, len(zres)*3)
 	for _, z := range zres {
 		id := z.Member.(string)
@@ -164,19 +537,6 @@ func (c *Client) ListMessages(qname string) ([]Message, error) {
 	for i, z := range zres {
 		id := z.Member.(string)
 
-		// Parse ID to get Sent time
-		// Match RSMQ implementation: parseInt(id.slice(0, 10), 36)
-		sent := time.Time{}
-		parseLen := 10
-		if len(id) < 10 {
-			parseLen = len(id)
-		}
-
-		if parseLen > 0 {
-			tsMs, _ := strconv.ParseInt(id[:parseLen], 36, 64)
-			sent = time.UnixMicro(tsMs)
-		}
-
 		body := ""
 		if val := hmres[i*3]; val != nil {
 			body = val.(string)
@@ -202,7 +562,7 @@ func (c *Client) ListMessages(qname string) ([]Message, error) {
 			Body:      body,
 			Rc:        rc,
 			Fr:        fr,
-			Sent:      sent,
+			Sent:      parseIDTime(id),
 			VisibleAt: time.UnixMilli(int64(z.Score)),
 		}
 	}
@@ -211,139 +571,535 @@ func (c *Client) ListMessages(qname string) ([]Message, error) {
 }
 
 func (c *Client) CreateQueue(qname string, vt, delay, maxsize int) error {
-	key := c.ns + qname + ":Q"
-	exists, err := c.rdb.Exists(key).Result()
-	if err != nil {
-		return err
-	}
-	if exists > 0 {
-		return errors.New("queue already exists")
-	}
+	return c.CreateQueueContext(context.Background(), qname, vt, delay, maxsize)
+}
+
+func (c *Client) CreateQueueContext(ctx context.Context, qname string, vt, delay, maxsize int) error {
+	return runWrite(ctx, func() error {
+		if err := ValidateQueueName(qname); err != nil {
+			return err
+		}
+		if err := ValidateQueueAttributes(vt, delay, maxsize); err != nil {
+			return &QueueError{Queue: qname, Err: err}
+		}
 
-	now := time.Now().Unix()
+		key := c.ns + qname + ":Q"
+		exists, err := c.rdb.Exists(key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return &QueueError{Queue: qname, Err: ErrQueueExists}
+		}
 
-	pipe := c.rdb.TxPipeline()
-	pipe.HMSet(key, map[string]interface{}{
-		"vt":        vt,
-		"delay":     delay,
-		"maxsize":   maxsize,
-		"created":   now,
-		"modified":  now,
-		"totalrecv": 0,
-		"totalsent": 0,
+		now, err := c.serverNow(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		pipe := c.rdb.TxPipeline()
+		pipe.HMSet(key, map[string]interface{}{
+			"vt":        vt,
+			"delay":     delay,
+			"maxsize":   maxsize,
+			"created":   now.Unix(),
+			"modified":  now.Unix(),
+			"totalrecv": 0,
+			"totalsent": 0,
+		})
+		pipe.SAdd(c.ns+"QUEUES", qname)
+		_, err = c.execTx(pipe)
+		return err
 	})
-	pipe.SAdd(c.ns+"QUEUES", qname)
-	_, err = pipe.Exec()
-	return err
 }
 
 func (c *Client) DeleteQueue(qname string) error {
-	pipe := c.rdb.TxPipeline()
-	pipe.Del(c.ns + qname + ":Q")
-	pipe.Del(c.ns + qname)
-	pipe.SRem(c.ns+"QUEUES", qname)
-	_, err := pipe.Exec()
-	return err
+	return c.DeleteQueueContext(context.Background(), qname)
+}
+
+func (c *Client) DeleteQueueContext(ctx context.Context, qname string) error {
+	return runWrite(ctx, func() error {
+		pipe := c.rdb.TxPipeline()
+		pipe.Del(c.ns + qname + ":Q")
+		pipe.Del(c.ns + qname)
+		pipe.SRem(c.ns+"QUEUES", qname)
+		_, err := c.execTx(pipe)
+		return err
+	})
 }
 
 func (c *Client) SetQueueAttributes(qname string, vt, delay, maxsize int) error {
-	key := c.ns + qname + ":Q"
-	now := time.Now().Unix()
+	return c.SetQueueAttributesContext(context.Background(), qname, vt, delay, maxsize)
+}
 
-	exists, err := c.rdb.Exists(key).Result()
-	if err != nil {
+func (c *Client) SetQueueAttributesContext(ctx context.Context, qname string, vt, delay, maxsize int) error {
+	return runWrite(ctx, func() error {
+		if err := ValidateQueueAttributes(vt, delay, maxsize); err != nil {
+			return &QueueError{Queue: qname, Err: err}
+		}
+
+		key := c.ns + qname + ":Q"
+
+		exists, err := c.rdb.Exists(key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return &QueueError{Queue: qname, Err: ErrQueueNotFound}
+		}
+
+		now, err := c.serverNow(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		_, err = c.rdb.HMSet(key, map[string]interface{}{
+			"vt":       vt,
+			"delay":    delay,
+			"maxsize":  maxsize,
+			"modified": now.Unix(),
+		}).Result()
 		return err
-	}
-	if exists == 0 {
-		return errors.New("queue not found")
-	}
+	})
+}
 
-	_, err = c.rdb.HMSet(key, map[string]interface{}{
-		"vt":       vt,
-		"delay":    delay,
-		"maxsize":  maxsize,
-		"modified": now,
-	}).Result()
-	return err
+// SendMessageOptions controls when a message sent with SendMessageWithOptions
+// becomes visible.
+type SendMessageOptions struct {
+	// Delay in seconds before the message becomes visible. If nil, the
+	// queue's delay attribute is used.
+	Delay *int
+	// VisibleAt schedules the message for an absolute time. If set, it
+	// takes precedence over Delay.
+	VisibleAt time.Time
 }
 
 func (c *Client) SendMessage(qname string, message string) error {
-	stats, err := c.GetQueueStats(qname)
-	if err != nil {
-		return err
-	}
+	return c.SendMessageContext(context.Background(), qname, message)
+}
 
-	if len(message) > stats.MaxSize {
-		return errors.New("message too long")
-	}
+func (c *Client) SendMessageContext(ctx context.Context, qname string, message string) error {
+	return c.SendMessageWithOptionsContext(ctx, qname, message, SendMessageOptions{})
+}
 
-	id := c.generateID()
-	now := time.Now().UnixMilli()
-	score := now + int64(stats.Delay*1000)
+func (c *Client) SendMessageWithOptions(qname string, message string, opts SendMessageOptions) error {
+	return c.SendMessageWithOptionsContext(context.Background(), qname, message, opts)
+}
 
-	keyQ := c.ns + qname + ":Q"
-	keyZ := c.ns + qname
+func (c *Client) SendMessageWithOptionsContext(ctx context.Context, qname string, message string, opts SendMessageOptions) error {
+	return runWrite(ctx, func() error {
+		stats, err := c.GetQueueStatsContext(ctx, qname)
+		if err != nil {
+			return err
+		}
+
+		if stats.MaxSize != UnlimitedMaxSize && len(message) > stats.MaxSize {
+			return &QueueError{Queue: qname, Err: fmt.Errorf("%w (%d bytes, max %d)", ErrMessageTooLong, len(message), stats.MaxSize)}
+		}
+
+		delay := stats.Delay
+		if opts.Delay != nil {
+			if err := ValidateDelay(*opts.Delay); err != nil {
+				return &QueueError{Queue: qname, Err: err}
+			}
+			delay = *opts.Delay
+		}
+
+		nowT, err := c.serverNow(ctx)
+		if err != nil {
+			return err
+		}
+		id := c.generateID(nowT)
+		now := nowT.UnixMilli()
+		score := now + int64(delay*1000)
+		if !opts.VisibleAt.IsZero() {
+			score = opts.VisibleAt.UnixMilli()
+		}
+
+		keyQ := c.ns + qname + ":Q"
+		keyZ := c.ns + qname
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		pipe := c.rdb.TxPipeline()
+		pipe.ZAdd(keyZ, redis.Z{Score: float64(score), Member: id})
+		pipe.HMSet(keyQ, map[string]interface{}{
+			id:           message,
+			id + ":rc":   0,
+			id + ":fr":   0,
+			id + ":sent": now,
+		})
+		pipe.HIncrBy(keyQ, "totalsent", 1)
+		zcard := pipe.ZCard(keyZ)
+
+		_, err = c.execTx(pipe)
+		if err != nil {
+			return err
+		}
+
+		// Match rsmq: publish the queue length after the transaction and
+		// ignore the result. The message is already sent, so failing here
+		// would only invite a duplicate resend.
+		if c.realtime {
+			c.rdb.Publish(c.ns+"rt:"+qname, zcard.Val())
+		}
+		return nil
+	})
+}
+
+// receiveMessageScript follows the Node rsmq receiveMessage script, updating
+// the same counters and fields so the two implementations can share queues.
+// KEYS: queue key, now (ms), new visibility score (ms).
+var receiveMessageScript = redis.NewScript(`local msg = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", KEYS[2], "LIMIT", "0", "1")
+if #msg == 0 then
+	return {}
+end
+redis.call("ZADD", KEYS[1], KEYS[3], msg[1])
+redis.call("HINCRBY", KEYS[1] .. ":Q", "totalrecv", 1)
+local mbody = redis.call("HGET", KEYS[1] .. ":Q", msg[1])
+local rc = redis.call("HINCRBY", KEYS[1] .. ":Q", msg[1] .. ":rc", 1)
+local o = {msg[1], mbody, rc}
+if rc==1 then
+	redis.call("HSET", KEYS[1] .. ":Q", msg[1] .. ":fr", KEYS[2])
+	table.insert(o, KEYS[2])
+else
+	local fr = redis.call("HGET", KEYS[1] .. ":Q", msg[1] .. ":fr")
+	table.insert(o, fr)
+end
+return o`)
+
+// ReceiveMessage receives the oldest visible message and hides it for vt
+// seconds. It returns a nil message if no message is currently visible.
+func (c *Client) ReceiveMessage(qname string, vt int) (*Message, error) {
+	return c.ReceiveMessageContext(context.Background(), qname, vt)
+}
+
+func (c *Client) ReceiveMessageContext(ctx context.Context, qname string, vt int) (*Message, error) {
+	return doWrite(ctx, func() (*Message, error) {
+		if err := ValidateVt(vt); err != nil {
+			return nil, &QueueError{Queue: qname, Err: err}
+		}
+
+		keyQ := c.ns + qname + ":Q"
+		keyZ := c.ns + qname
+
+		exists, err := c.rdb.Exists(keyQ).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, &QueueError{Queue: qname, Err: ErrQueueNotFound}
+		}
+
+		nowT, err := c.serverNow(ctx)
+		if err != nil {
+			return nil, err
+		}
+		now := nowT.UnixMilli()
+		visibleAt := now + int64(vt*1000)
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		res, err := receiveMessageScript.Run(c.rdb, []string{
+			keyZ,
+			strconv.FormatInt(now, 10),
+			strconv.FormatInt(visibleAt, 10),
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		msg := parseScriptMessage(res)
+		if msg != nil {
+			msg.VisibleAt = time.UnixMilli(visibleAt)
+		}
+		return msg, nil
+	})
+}
+
+// popMessageScript is the Node rsmq popMessage script, additionally removing
+// the ":sent" field written by SendMessage.
+// KEYS: queue key, now (ms).
+var popMessageScript = redis.NewScript(`local msg = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", KEYS[2], "LIMIT", "0", "1")
+if #msg == 0 then
+	return {}
+end
+redis.call("HINCRBY", KEYS[1] .. ":Q", "totalrecv", 1)
+local mbody = redis.call("HGET", KEYS[1] .. ":Q", msg[1])
+local rc = redis.call("HINCRBY", KEYS[1] .. ":Q", msg[1] .. ":rc", 1)
+local o = {msg[1], mbody, rc}
+if rc==1 then
+	table.insert(o, KEYS[2])
+else
+	local fr = redis.call("HGET", KEYS[1] .. ":Q", msg[1] .. ":fr")
+	table.insert(o, fr)
+end
+redis.call("ZREM", KEYS[1], msg[1])
+redis.call("HDEL", KEYS[1] .. ":Q", msg[1], msg[1] .. ":rc", msg[1] .. ":fr", msg[1] .. ":sent")
+return o`)
+
+// PopMessage atomically receives and deletes the oldest visible message.
+// It returns a nil message if no message is currently visible.
+func (c *Client) PopMessage(qname string) (*Message, error) {
+	return c.PopMessageContext(context.Background(), qname)
+}
+
+func (c *Client) PopMessageContext(ctx context.Context, qname string) (*Message, error) {
+	return doWrite(ctx, func() (*Message, error) {
+		keyQ := c.ns + qname + ":Q"
+		keyZ := c.ns + qname
+
+		exists, err := c.rdb.Exists(keyQ).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, &QueueError{Queue: qname, Err: ErrQueueNotFound}
+		}
+
+		nowT, err := c.serverNow(ctx)
+		if err != nil {
+			return nil, err
+		}
+		now := nowT.UnixMilli()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		res, err := popMessageScript.Run(c.rdb, []string{
+			keyZ,
+			strconv.FormatInt(now, 10),
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
 
-	pipe := c.rdb.TxPipeline()
-	pipe.ZAdd(keyZ, redis.Z{Score: float64(score), Member: id})
-	pipe.HMSet(keyQ, map[string]interface{}{
-		id:           message,
-		id + ":rc":   0,
-		id + ":fr":   0,
-		id + ":sent": now,
+		return parseScriptMessage(res), nil
 	})
-	pipe.HIncrBy(keyQ, "totalsent", 1)
+}
+
+// changeMessageVisibilityScript is the Node rsmq changeMessageVisibility script.
+// KEYS: queue key, message id, new visibility score (ms).
+var changeMessageVisibilityScript = redis.NewScript(`local msg = redis.call("ZSCORE", KEYS[1], KEYS[2])
+if not msg then
+	return 0
+end
+redis.call("ZADD", KEYS[1], KEYS[3], KEYS[2])
+return 1`)
+
+// ChangeMessageVisibility makes the message visible vt seconds from now.
+// A vt of 0 makes the message visible immediately.
+func (c *Client) ChangeMessageVisibility(qname string, id string, vt int) error {
+	return c.ChangeMessageVisibilityContext(context.Background(), qname, id, vt)
+}
 
-	_, err = pipe.Exec()
-	return err
+func (c *Client) ChangeMessageVisibilityContext(ctx context.Context, qname string, id string, vt int) error {
+	return runWrite(ctx, func() error {
+		if err := ValidateVt(vt); err != nil {
+			return &MessageError{Queue: qname, ID: id, Err: err}
+		}
+
+		keyQ := c.ns + qname + ":Q"
+		keyZ := c.ns + qname
+
+		exists, err := c.rdb.Exists(keyQ).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return &QueueError{Queue: qname, Err: ErrQueueNotFound}
+		}
+
+		now, err := c.serverNow(ctx)
+		if err != nil {
+			return err
+		}
+		visibleAt := now.UnixMilli() + int64(vt*1000)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		res, err := changeMessageVisibilityScript.Run(c.rdb, []string{
+			keyZ,
+			id,
+			strconv.FormatInt(visibleAt, 10),
+		}).Int64()
+		if err != nil {
+			return err
+		}
+		if res == 0 {
+			return &MessageError{Queue: qname, ID: id, Err: ErrMessageNotFound}
+		}
+		return nil
+	})
 }
 
 func (c *Client) DeleteMessage(qname string, id string) error {
-	keyQ := c.ns + qname + ":Q"
-	keyZ := c.ns + qname
+	return c.DeleteMessageContext(context.Background(), qname, id)
+}
 
-	pipe := c.rdb.TxPipeline()
-	pipe.ZRem(keyZ, id)
-	pipe.HDel(keyQ, id, id+":rc", id+":fr", id+":sent")
-	_, err := pipe.Exec()
-	return err
+func (c *Client) DeleteMessageContext(ctx context.Context, qname string, id string) error {
+	return runWrite(ctx, func() error {
+		keyQ := c.ns + qname + ":Q"
+		keyZ := c.ns + qname
+
+		pipe := c.rdb.TxPipeline()
+		pipe.ZRem(keyZ, id)
+		pipe.HDel(keyQ, id, id+":rc", id+":fr", id+":sent")
+		_, err := c.execTx(pipe)
+		return err
+	})
+}
+
+// DefaultClearBatchSize is used by ClearQueueWithOptions when BatchSize <= 0.
+const DefaultClearBatchSize = 1000
+
+// ClearQueueOptions controls how ClearQueueWithOptions removes messages.
+type ClearQueueOptions struct {
+	// BatchSize is the number of messages removed per Redis call. Each
+	// batch blocks the server while it runs.
+	BatchSize int64
+	// Progress, if set, is called after each batch with the number of
+	// messages removed so far and the queue length when clearing started,
+	// raised to the number removed if messages were sent meanwhile.
+	Progress func(cleared, total int64)
 }
 
 func (c *Client) ClearQueue(qname string) error {
+	return c.ClearQueueContext(context.Background(), qname)
+}
+
+func (c *Client) ClearQueueContext(ctx context.Context, qname string) error {
+	return c.ClearQueueWithOptionsContext(ctx, qname, ClearQueueOptions{})
+}
+
+func (c *Client) ClearQueueWithOptions(qname string, opts ClearQueueOptions) error {
+	return c.ClearQueueWithOptionsContext(context.Background(), qname, opts)
+}
+
+// ClearQueueWithOptionsContext removes the messages of a queue in batches,
+// each one atomic, so large queues never block the server for long. The clear
+// is bounded by the highest visibility score when it starts: it removes every
+// message scheduled up to that point and stops once none are left, so messages
+// sent later but due earlier are removed too, while a message received during
+// the clear with a longer vt survives. If ctx is cancelled between batches the
+// queue is left partially cleared.
+func (c *Client) ClearQueueWithOptionsContext(ctx context.Context, qname string, opts ClearQueueOptions) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultClearBatchSize
+	}
 	keyQ := c.ns + qname + ":Q"
 	keyZ := c.ns + qname
 
-	// Get all message IDs
-	ids, err := c.rdb.ZRange(keyZ, 0, -1).Result()
-	if err != nil {
+	var total int64
+	var last []redis.Z
+	err := run(ctx, func() error {
+		pipe := c.rdb.Pipeline()
+		card := pipe.ZCard(keyZ)
+		tail := pipe.ZRangeWithScores(keyZ, -1, -1)
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+		total, last = card.Val(), tail.Val()
+		return nil
+	})
+	if err != nil || len(last) == 0 {
 		return err
 	}
-	if len(ids) == 0 {
+	bound := strconv.FormatFloat(last[0].Score, 'f', -1, 64)
+
+	var cleared int64
+	for {
+		n, err := doWrite(ctx, func() (int64, error) {
+			return clearBatchScript.Run(c.rdb, []string{keyZ, keyQ}, bound, batchSize).Int64()
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		cleared += n
+		// Messages sent during the clear may push past the initial count
+		total = max(total, cleared)
+		if opts.Progress != nil {
+			opts.Progress(cleared, total)
+		}
+	}
+}
+
+// clearBatchScript removes up to ARGV[2] messages scored at most ARGV[1] and
+// their hash fields, returning the number removed. They are the lowest ranked
+// members, so a single ZREMRANGEBYRANK removes them.
+var clearBatchScript = redis.NewScript(`local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call("HDEL", KEYS[2], id, id .. ":rc", id .. ":fr", id .. ":sent")
+end
+if #ids > 0 then
+	redis.call("ZREMRANGEBYRANK", KEYS[1], 0, #ids - 1)
+end
+return #ids`)
+
+// parseScriptMessage converts the {id, body, rc, fr} reply returned by the
+// rsmq receive/pop scripts into a Message. An empty reply yields nil.
+func parseScriptMessage(res interface{}) *Message {
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) < 4 {
 		return nil
 	}
 
-	// Prepare fields to delete from Hash
-	fields := make([]string, 0, len(ids)*4)
-	for _, id := range ids {
-		fields = append(fields, id, id+":rc", id+":fr", id+":sent")
+	msg := &Message{}
+	msg.ID, _ = vals[0].(string)
+	msg.Body, _ = vals[1].(string)
+	if rc, ok := vals[2].(int64); ok {
+		msg.Rc = int(rc)
 	}
+	if s, ok := vals[3].(string); ok {
+		frMs, _ := strconv.ParseInt(s, 10, 64)
+		msg.Fr = time.UnixMilli(frMs)
+	}
+	msg.Sent = parseIDTime(msg.ID)
+	return msg
+}
 
-	pipe := c.rdb.TxPipeline()
-	pipe.HDel(keyQ, fields...)
-	pipe.Del(keyZ)
-	_, err = pipe.Exec()
-	return err
+// parseIDTime extracts the sent time encoded in a message ID.
+// Match RSMQ implementation: parseInt(id.slice(0, 10), 36)
+func parseIDTime(id string) time.Time {
+	parseLen := 10
+	if len(id) < 10 {
+		parseLen = len(id)
+	}
+	if parseLen == 0 {
+		return time.Time{}
+	}
+	tsMs, _ := strconv.ParseInt(id[:parseLen], 36, 64)
+	return time.UnixMicro(tsMs)
 }
 
 const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
 
-func (c *Client) generateID() string {
+func (c *Client) generateID(now time.Time) string {
 	// RSMQ uses microsecond precision for the ID timestamp part
 	// Logic: Number(seconds + microseconds).toString(36)
 	// Go's UnixMicro returns the number of microseconds elapsed since January 1, 1970 UTC.
 	// This is equivalent to seconds*1e6 + microseconds, which matches the JS logic
 	// assuming the JS logic intends to create a full microsecond timestamp.
-	ts := strconv.FormatInt(time.Now().UnixMicro(), 36)
+	ts := strconv.FormatInt(now.UnixMicro(), 36)
 	if len(ts) < 10 {
 		ts = strings.Repeat("0", 10-len(ts)) + ts
 	}
@@ -0,0 +1,93 @@
+package rsmq
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func TestQueueStats(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	sent := now.Add(-90 * time.Second)
+	id := strconv.FormatInt(sent.UnixMicro(), 36)
+
+	tests := []struct {
+		name   string
+		attrs  []interface{}
+		oldest string
+		want   *QueueStats
+	}{
+		{"missing", []interface{}{nil, nil, nil, nil, nil, nil, nil}, "", nil},
+		{"no oldest", []interface{}{"30", "0", "-1", "4", "5", "1600000000", "1650000000"}, "", &QueueStats{
+			Name: "q", Vt: 30, MaxSize: UnlimitedMaxSize, TotalRecv: 4, TotalSent: 5,
+			Created: time.Unix(1600000000, 0), Modified: time.Unix(1650000000, 0), Msgs: 3, HiddenMsgs: 1,
+		}},
+		{"oldest", []interface{}{"30", "0", "65536", "0", "1", "1600000000", "1600000000"}, id, &QueueStats{
+			Name: "q", Vt: 30, MaxSize: MaxMaxSize, TotalSent: 1,
+			Created: time.Unix(1600000000, 0), Modified: time.Unix(1600000000, 0), Msgs: 3, HiddenMsgs: 1,
+			OldestAge: 90 * time.Second,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmds := queueStatsCmds{
+				attrs:  redis.NewSliceResult(tt.attrs, nil),
+				msgs:   redis.NewIntResult(3, nil),
+				hidden: redis.NewIntResult(1, nil),
+				oldest: redis.NewCmdResult(tt.oldest, nil),
+			}
+			got := cmds.stats("q", now)
+			switch {
+			case got == nil || tt.want == nil:
+				if got != tt.want {
+					t.Fatalf("stats() = %+v, want %+v", got, tt.want)
+				}
+			case *got != *tt.want:
+				t.Errorf("stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScriptMessage(t *testing.T) {
+	sent := time.UnixMilli(1700000000000)
+	id := strconv.FormatInt(sent.UnixMicro(), 36) + "abcdefghijklmnopqrstuv"
+	fr := time.UnixMilli(1700000005000)
+
+	tests := []struct {
+		name string
+		res  interface{}
+		want *Message
+	}{
+		{"nil", nil, nil},
+		{"no message", []interface{}{}, nil},
+		{"short reply", []interface{}{id, "body", int64(1)}, nil},
+		{"first receive", []interface{}{id, "body", int64(1), "1700000005000"}, &Message{
+			ID: id, Body: "body", Rc: 1, Fr: fr, Sent: sent,
+		}},
+		{"received before", []interface{}{id, "", int64(3), "1700000005000"}, &Message{
+			ID: id, Rc: 3, Fr: fr, Sent: sent,
+		}},
+		{"missing fields", []interface{}{id, nil, nil, nil}, &Message{
+			ID: id, Sent: sent,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseScriptMessage(tt.res)
+			switch {
+			case got == nil || tt.want == nil:
+				if got != tt.want {
+					t.Fatalf("parseScriptMessage() = %+v, want %+v", got, tt.want)
+				}
+			case got.ID != tt.want.ID || got.Body != tt.want.Body || got.Rc != tt.want.Rc ||
+				!got.Fr.Equal(tt.want.Fr) || !got.Sent.Equal(tt.want.Sent) || !got.VisibleAt.Equal(tt.want.VisibleAt):
+				t.Errorf("parseScriptMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
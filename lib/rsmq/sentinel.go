@@ -0,0 +1,166 @@
+package rsmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// SentinelOptions configures a connection through Redis Sentinel.
+type SentinelOptions struct {
+	MasterName string
+	Addrs      []string // host:port of one or more sentinels
+}
+
+// newSentinelClient creates a client on go-redis's failover client, which
+// asks the sentinels for the current master and reconnects when they announce
+// a failover.
+func newSentinelClient(opts ClientOptions, ns string) (*Client, error) {
+	// The failover client dials the master itself, over plain TCP, so none
+	// of the other connection options would be applied
+	switch {
+	case opts.Sentinel.MasterName == "":
+		return nil, errors.New("sentinel master name is required")
+	case len(opts.Sentinel.Addrs) == 0:
+		return nil, errors.New("at least one sentinel address is required")
+	case opts.Network != "" && opts.Network != "tcp":
+		return nil, errors.New("sentinel connections cannot use unix sockets")
+	case opts.Dialer != nil:
+		return nil, errors.New("sentinel connections cannot use an SSH tunnel or custom dialer")
+	case opts.TLS != nil:
+		return nil, errors.New("sentinel connections do not support TLS")
+	}
+
+	sentinel := &SentinelOptions{
+		MasterName: opts.Sentinel.MasterName,
+		Addrs:      append([]string(nil), opts.Sentinel.Addrs...),
+	}
+	fopts := &redis.FailoverOptions{
+		MasterName: sentinel.MasterName,
+		// The failover client reorders the list and adds discovered sentinels
+		SentinelAddrs: append([]string(nil), sentinel.Addrs...),
+		Password:      opts.Password,
+		DB:            opts.DB,
+	}
+	if opts.Username != "" {
+		fopts.Password = ""
+		fopts.DB = 0
+		fopts.OnConnect = aclOnConnect(opts)
+	}
+
+	sentinels := make([]*redis.SentinelClient, len(sentinel.Addrs))
+	for i, addr := range sentinel.Addrs {
+		sentinels[i] = redis.NewSentinelClient(&redis.Options{Addr: addr})
+	}
+
+	return &Client{
+		rdb:       redis.NewFailoverClient(fopts),
+		db:        opts.DB,
+		ns:        ns,
+		clock:     &serverClock{},
+		sentinel:  sentinel,
+		sentinels: sentinels,
+	}, nil
+}
+
+// Sentinel returns the Sentinel options of the client, or nil if it connects
+// to a fixed address.
+func (c *Client) Sentinel() *SentinelOptions {
+	return c.sentinel
+}
+
+func (c *Client) MasterAddr() (string, error) {
+	return c.MasterAddrContext(context.Background())
+}
+
+// MasterAddrContext returns the address of the Redis server the client talks
+// to: the master the sentinels currently report for Sentinel connections, or
+// the configured address otherwise.
+func (c *Client) MasterAddrContext(ctx context.Context) (string, error) {
+	if c.sentinel == nil {
+		return c.rdb.Options().Addr, nil
+	}
+
+	var errs []error
+	for i, addr := range c.sentinel.Addrs {
+		master, err := do(ctx, func() ([]string, error) {
+			return c.sentinels[i].GetMasterAddrByName(c.sentinel.MasterName).Result()
+		})
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err == nil && len(master) == 2 {
+			return net.JoinHostPort(master[0], master[1]), nil
+		}
+		if err == nil || err == redis.Nil {
+			err = fmt.Errorf("unknown master %q", c.sentinel.MasterName)
+		}
+		errs = append(errs, fmt.Errorf("sentinel %s: %w", addr, err))
+	}
+	return "", errors.Join(errs...)
+}
+
+// SubscribeMaster subscribes to the failover announcements (+switch-master)
+// of the first reachable sentinel. The returned channel receives the address
+// of the new master after every failover of the client's master, and is
+// closed once ctx is done. The client itself follows failovers without it.
+func (c *Client) SubscribeMaster(ctx context.Context) (<-chan string, error) {
+	if c.sentinel == nil {
+		return nil, errors.New("not a sentinel connection")
+	}
+
+	var pubsub *redis.PubSub
+	var errs []error
+	for i, addr := range c.sentinel.Addrs {
+		// The subscription has its own connection, closed with it
+		pubsub = c.sentinels[i].Subscribe("+switch-master")
+		// Wait for the subscription to be confirmed so errors surface here
+		_, err := do(ctx, pubsub.Receive)
+		if err == nil {
+			break
+		}
+		pubsub.Close()
+		pubsub = nil
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("sentinel %s: %w", addr, err))
+	}
+	if pubsub == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	out := make(chan string, 4)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				// <master name> <old ip> <old port> <new ip> <new port>
+				parts := strings.Fields(msg.Payload)
+				if len(parts) != 5 || parts[0] != c.sentinel.MasterName {
+					continue
+				}
+				select {
+				case out <- net.JoinHostPort(parts[3], parts[4]):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -1,6 +1,7 @@
 package rsmq
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -39,11 +40,12 @@ func DialSSH(cfg SSHConfig) (func(network, addr string) (net.Conn, error), error
 		}
 
 		if err != nil {
-			// If parsing fails, it might be an encrypted key without a passphrase
-			// or just an invalid key. The caller should handle the prompt logic
-			// if they suspect a missing passphrase, or we can check the error type
-			// but x/crypto/ssh doesn't always make it easy to distinguish.
-			// For now, return the error.
+			// An encrypted key without a passphrase is reported separately so
+			// the caller can prompt for one and retry.
+			var missing *ssh.PassphraseMissingError
+			if errors.As(err, &missing) {
+				return nil, fmt.Errorf("unable to parse private key: %w", ErrPassphraseRequired)
+			}
 			return nil, fmt.Errorf("unable to parse private key: %v", err)
 		}
 		authMethods = append(authMethods, ssh.PublicKeys(signer))
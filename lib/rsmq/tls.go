@@ -0,0 +1,60 @@
+package rsmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// TLSOptions configures TLS for the Redis connection.
+type TLSOptions struct {
+	CAFile     string // PEM CA bundle; the system roots are used if empty
+	CertFile   string // Optional PEM client certificate
+	KeyFile    string // PEM private key of the client certificate
+	ServerName string // SNI and verified name; defaults to the host of the address
+	// InsecureSkipVerify disables server certificate verification
+	InsecureSkipVerify bool
+}
+
+// Config builds a tls.Config for connecting to addr.
+func (o *TLSOptions) Config(addr string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	// Default to the host of the address, which for SSH tunnels is the host
+	// as seen from the SSH server. Set ServerName when the certificate
+	// names another host, e.g. when addr is an IP address.
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg.ServerName = host
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,106 @@
+package rsmq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and its key to dir and
+// returns their paths.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+	badFile := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(badFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       TLSOptions
+		addr       string
+		serverName string
+		wantErr    bool
+	}{
+		{"host and port", TLSOptions{}, "redis.example.com:6380", "redis.example.com", false},
+		{"host only", TLSOptions{}, "redis.example.com", "redis.example.com", false},
+		{"IPv6", TLSOptions{}, "[::1]:6380", "::1", false},
+		{"explicit server name", TLSOptions{ServerName: "redis.test"}, "10.0.0.1:6380", "redis.test", false},
+		{"CA file", TLSOptions{CAFile: certFile}, "redis.test:6380", "redis.test", false},
+		{"missing CA file", TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}, "redis.test:6380", "", true},
+		{"bad CA file", TLSOptions{CAFile: badFile}, "redis.test:6380", "", true},
+		{"client certificate", TLSOptions{CertFile: certFile, KeyFile: keyFile}, "redis.test:6380", "redis.test", false},
+		{"key without certificate", TLSOptions{KeyFile: keyFile}, "redis.test:6380", "", true},
+		{"mismatched key pair", TLSOptions{CertFile: certFile, KeyFile: badFile}, "redis.test:6380", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.opts.Config(tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Config() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Config() failed: %v", err)
+			}
+			if cfg.ServerName != tt.serverName {
+				t.Errorf("ServerName = %q, want %q", cfg.ServerName, tt.serverName)
+			}
+			if (cfg.RootCAs != nil) != (tt.opts.CAFile != "") {
+				t.Errorf("RootCAs = %v, want a pool only with a CA file", cfg.RootCAs)
+			}
+			want := 0
+			if tt.opts.CertFile != "" {
+				want = 1
+			}
+			if len(cfg.Certificates) != want {
+				t.Errorf("got %d client certificates, want %d", len(cfg.Certificates), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package rsmq
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseURL parses a connection URL into client options. Supported forms:
+//
+//	redis://[[user]:password@]host[:port][/db][?ns=namespace]
+//	rediss://...   (TLS; also ?servername=name&insecure=true)
+//	unix://[[user]:password@]/path/to/redis.sock[?db=N&ns=namespace]
+func ParseURL(rawurl string) (ClientOptions, error) {
+	var opts ClientOptions
+
+	u, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil {
+		return opts, err
+	}
+	q := u.Query()
+
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	if p := q.Get("password"); p != "" {
+		opts.Password = p
+	}
+	opts.NS = q.Get("ns")
+
+	db := q.Get("db")
+	switch u.Scheme {
+	case "redis", "rediss":
+		host, port := u.Hostname(), u.Port()
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "6379"
+		}
+		opts.Addr = net.JoinHostPort(host, port)
+
+		if path := strings.Trim(u.Path, "/"); path != "" {
+			db = path
+		}
+
+		if u.Scheme == "rediss" {
+			opts.TLS = &TLSOptions{ServerName: q.Get("servername")}
+			if insecure := q.Get("insecure"); insecure != "" {
+				opts.TLS.InsecureSkipVerify, err = strconv.ParseBool(insecure)
+				if err != nil {
+					return opts, fmt.Errorf("invalid insecure parameter %q", insecure)
+				}
+			}
+		}
+	case "unix":
+		if u.Path == "" {
+			return opts, fmt.Errorf("missing socket path in %q", rawurl)
+		}
+		opts.Network = "unix"
+		opts.Addr = u.Path
+	default:
+		return opts, fmt.Errorf("unsupported URL scheme %q (want redis, rediss or unix)", u.Scheme)
+	}
+
+	if db != "" {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil || opts.DB < 0 {
+			return opts, fmt.Errorf("invalid database number %q", db)
+		}
+	}
+
+	return opts, nil
+}
+
+// FormatURL renders opts as a connection URL understood by ParseURL. The
+// password is left out unless withPassword is set. Dialers and TLS files are
+// local settings and are not included.
+func FormatURL(opts ClientOptions, withPassword bool) string {
+	u := &url.URL{Scheme: "redis"}
+	q := url.Values{}
+
+	if opts.Username != "" || (withPassword && opts.Password != "") {
+		if withPassword && opts.Password != "" {
+			u.User = url.UserPassword(opts.Username, opts.Password)
+		} else {
+			u.User = url.User(opts.Username)
+		}
+	}
+
+	if opts.Network == "unix" {
+		u.Scheme = "unix"
+		u.Path = opts.Addr
+		if opts.DB != 0 {
+			q.Set("db", strconv.Itoa(opts.DB))
+		}
+	} else {
+		u.Host = opts.Addr
+		if opts.DB != 0 {
+			u.Path = "/" + strconv.Itoa(opts.DB)
+		}
+		if opts.TLS != nil {
+			u.Scheme = "rediss"
+			if opts.TLS.ServerName != "" {
+				q.Set("servername", opts.TLS.ServerName)
+			}
+			if opts.TLS.InsecureSkipVerify {
+				q.Set("insecure", "true")
+			}
+		}
+	}
+
+	if opts.NS != "" {
+		q.Set("ns", opts.NS)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,62 @@
+package rsmq
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Limits enforced by Node rsmq. Queues outside them cannot be used from rsmq.
+const (
+	MaxQueueNameLength = 160
+	MaxVt              = 9999999
+	MaxDelay           = 9999999
+	MinMaxSize         = 1024
+	MaxMaxSize         = 65536
+	// UnlimitedMaxSize disables the message size limit
+	UnlimitedMaxSize = -1
+)
+
+var queueNameRe = regexp.MustCompile(`^([a-zA-Z0-9_-]){1,160}$`)
+
+// ValidateQueueName checks qname against rsmq's queue name rules.
+func ValidateQueueName(qname string) error {
+	if !queueNameRe.MatchString(qname) {
+		return &QueueError{Queue: qname, Err: fmt.Errorf("%w: must be 1-%d letters, digits, '_' or '-'", ErrInvalidQueueName, MaxQueueNameLength)}
+	}
+	return nil
+}
+
+// ValidateVt checks a visibility timeout in seconds.
+func ValidateVt(vt int) error {
+	if vt < 0 || vt > MaxVt {
+		return fmt.Errorf("%w: vt must be between 0 and %d", ErrInvalidAttribute, MaxVt)
+	}
+	return nil
+}
+
+// ValidateDelay checks a delay in seconds.
+func ValidateDelay(delay int) error {
+	if delay < 0 || delay > MaxDelay {
+		return fmt.Errorf("%w: delay must be between 0 and %d", ErrInvalidAttribute, MaxDelay)
+	}
+	return nil
+}
+
+// ValidateMaxSize checks a maximum message size in bytes.
+func ValidateMaxSize(maxsize int) error {
+	if maxsize != UnlimitedMaxSize && (maxsize < MinMaxSize || maxsize > MaxMaxSize) {
+		return fmt.Errorf("%w: maxsize must be between %d and %d, or %d for no limit", ErrInvalidAttribute, MinMaxSize, MaxMaxSize, UnlimitedMaxSize)
+	}
+	return nil
+}
+
+// ValidateQueueAttributes checks queue attributes against rsmq's rules.
+func ValidateQueueAttributes(vt, delay, maxsize int) error {
+	if err := ValidateVt(vt); err != nil {
+		return err
+	}
+	if err := ValidateDelay(delay); err != nil {
+		return err
+	}
+	return ValidateMaxSize(maxsize)
+}
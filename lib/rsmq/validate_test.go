@@ -0,0 +1,63 @@
+package rsmq
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateQueueName(t *testing.T) {
+	tests := []struct {
+		qname string
+		valid bool
+	}{
+		{"jobs", true},
+		{"my-queue_2", true},
+		{strings.Repeat("a", MaxQueueNameLength), true},
+		{"", false},
+		{strings.Repeat("a", MaxQueueNameLength+1), false},
+		{"with:colon", false},
+		{"with space", false},
+		{"ünicode", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateQueueName(tt.qname)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateQueueName(%q) = %v, want valid %v", tt.qname, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidQueueName) {
+			t.Errorf("ValidateQueueName(%q) = %v, want ErrInvalidQueueName", tt.qname, err)
+		}
+	}
+}
+
+func TestValidateQueueAttributes(t *testing.T) {
+	tests := []struct {
+		name               string
+		vt, delay, maxsize int
+		valid              bool
+	}{
+		{"defaults", 30, 0, MaxMaxSize, true},
+		{"limits", MaxVt, MaxDelay, MinMaxSize, true},
+		{"unlimited maxsize", 0, 0, UnlimitedMaxSize, true},
+		{"negative vt", -1, 0, MaxMaxSize, false},
+		{"vt too large", MaxVt + 1, 0, MaxMaxSize, false},
+		{"negative delay", 30, -1, MaxMaxSize, false},
+		{"delay too large", 30, MaxDelay + 1, MaxMaxSize, false},
+		{"maxsize too small", 30, 0, MinMaxSize - 1, false},
+		{"maxsize too large", 30, 0, MaxMaxSize + 1, false},
+		{"maxsize zero", 30, 0, 0, false},
+		{"maxsize -2", 30, 0, -2, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateQueueAttributes(tt.vt, tt.delay, tt.maxsize)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: ValidateQueueAttributes(%d, %d, %d) = %v, want valid %v", tt.name, tt.vt, tt.delay, tt.maxsize, err, tt.valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidAttribute) {
+			t.Errorf("%s: got %v, want ErrInvalidAttribute", tt.name, err)
+		}
+	}
+}
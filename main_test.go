@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/benjamesfleming/rsmqt/lib/rsmq"
+)
+
+func messagesWithIDs(ids ...string) []rsmq.Message {
+	msgs := make([]rsmq.Message, len(ids))
+	for i, id := range ids {
+		msgs[i] = rsmq.Message{ID: id}
+	}
+	return msgs
+}
+
+func positions(ids ...string) map[string]int {
+	pos := make(map[string]int, len(ids))
+	for i, id := range ids {
+		pos[id] = i
+	}
+	return pos
+}
+
+// bruteForceLongest returns the length of the longest subsequence of old
+// whose IDs are in increasing order in newPos, trying every subset.
+func bruteForceLongest(old []rsmq.Message, newPos map[string]int) int {
+	best := 0
+	for mask := 0; mask < 1<<len(old); mask++ {
+		last, n, ok := -1, 0, true
+		for row, msg := range old {
+			if mask&(1<<row) == 0 {
+				continue
+			}
+			pos, found := newPos[msg.ID]
+			if !found || pos <= last {
+				ok = false
+				break
+			}
+			last = pos
+			n++
+		}
+		if ok && n > best {
+			best = n
+		}
+	}
+	return best
+}
+
+func TestLongestOrderedRows(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []string
+		new  []string
+		want []int
+	}{
+		{"empty", nil, []string{"a"}, []int{}},
+		{"unchanged", []string{"a", "b", "c"}, []string{"a", "b", "c"}, []int{0, 1, 2}},
+		{"all removed", []string{"a", "b"}, nil, []int{}},
+		{"removed", []string{"a", "b", "c", "d"}, []string{"a", "c"}, []int{0, 2}},
+		{"inserted", []string{"a", "c"}, []string{"a", "b", "c", "d"}, []int{0, 1}},
+		{"received moves to end", []string{"a", "b", "c", "d"}, []string{"b", "c", "d", "a"}, []int{1, 2, 3}},
+		{"reversed", []string{"a", "b", "c"}, []string{"c", "b", "a"}, []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := longestOrderedRows(messagesWithIDs(tt.old...), positions(tt.new...))
+			if len(got) != len(tt.want) {
+				t.Fatalf("longestOrderedRows() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("longestOrderedRows() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLongestOrderedRowsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 500; iter++ {
+		// Old rows, some removed and the rest shuffled with new IDs mixed in
+		var oldIDs, newIDs []string
+		for i := 0; i < rng.Intn(10); i++ {
+			id := strconv.Itoa(i)
+			oldIDs = append(oldIDs, id)
+			if rng.Intn(4) > 0 {
+				newIDs = append(newIDs, id)
+			}
+		}
+		for i := 0; i < rng.Intn(3); i++ {
+			newIDs = append(newIDs, "new"+strconv.Itoa(i))
+		}
+		rng.Shuffle(len(newIDs), func(i, j int) { newIDs[i], newIDs[j] = newIDs[j], newIDs[i] })
+
+		old := messagesWithIDs(oldIDs...)
+		newPos := positions(newIDs...)
+		rows := longestOrderedRows(old, newPos)
+
+		if want := bruteForceLongest(old, newPos); len(rows) != want {
+			t.Fatalf("old %v, new %v: got %d rows %v, want %d", oldIDs, newIDs, len(rows), rows, want)
+		}
+		for i := 1; i < len(rows); i++ {
+			if rows[i] <= rows[i-1] || newPos[old[rows[i]].ID] <= newPos[old[rows[i-1]].ID] {
+				t.Fatalf("old %v, new %v: rows %v are not ordered", oldIDs, newIDs, rows)
+			}
+		}
+		for _, row := range rows {
+			if _, ok := newPos[old[row].ID]; !ok {
+				t.Fatalf("old %v, new %v: kept removed row %d", oldIDs, newIDs, row)
+			}
+		}
+	}
+}